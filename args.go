@@ -0,0 +1,40 @@
+package cobrautil
+
+import (
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+// MinimumArgsWithRest returns a cobra.PositionalArgs that requires at least n
+// arguments before a "--" separator and accepts any number of arguments after
+// it.
+//
+// The arguments on either side of the separator can be accessed with
+// ArgsBeforeDash() and RestArgs().
+func MinimumArgsWithRest(n int) cobra.PositionalArgs {
+	return func(cmd *cobra.Command, args []string) error {
+		if received := len(ArgsBeforeDash(cmd, args)); received < n {
+			return fmt.Errorf(`requires at least %d arg(s) before "--", only received %d`, n, received)
+		}
+		return nil
+	}
+}
+
+// ArgsBeforeDash returns the positional arguments that preceded a "--"
+// separator or all of the arguments if there was no separator.
+func ArgsBeforeDash(cmd *cobra.Command, args []string) []string {
+	if i := cmd.ArgsLenAtDash(); i >= 0 {
+		return args[:i]
+	}
+	return args
+}
+
+// RestArgs returns the positional arguments that followed a "--" separator or
+// nil if there was no separator.
+func RestArgs(cmd *cobra.Command, args []string) []string {
+	if i := cmd.ArgsLenAtDash(); i >= 0 {
+		return args[i:]
+	}
+	return nil
+}
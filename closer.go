@@ -0,0 +1,63 @@
+package cobrautil
+
+import (
+	"context"
+	"io"
+	"sync"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type closersKey struct{}
+
+type closers struct {
+	sync.Mutex
+	closers []io.Closer
+}
+
+// RegisterCloser stores the provided io.Closer in the context of the command
+// so that it is closed by CloseAll().
+//
+// This is intended to be called when resources are opened during a PreRun.
+func RegisterCloser(cmd *cobra.Command, c io.Closer) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	registry, ok := ctx.Value(closersKey{}).(*closers)
+	if !ok {
+		registry = &closers{}
+		cmd.SetContext(context.WithValue(ctx, closersKey{}, registry))
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	registry.closers = append(registry.closers, c)
+}
+
+// CloseAll closes every io.Closer registered with RegisterCloser() in the
+// reverse order that they were registered, logging any failures.
+//
+// This is intended to be called from a PersistentPostRun.
+func CloseAll(cmd *cobra.Command) {
+	ctx := cmd.Context()
+	if ctx == nil {
+		return
+	}
+
+	registry, ok := ctx.Value(closersKey{}).(*closers)
+	if !ok {
+		return
+	}
+
+	registry.Lock()
+	defer registry.Unlock()
+	for i := len(registry.closers) - 1; i >= 0; i-- {
+		if err := registry.closers[i].Close(); err != nil {
+			log.Warn().Err(err).Msg("failed to close resource")
+		}
+	}
+	registry.closers = nil
+}
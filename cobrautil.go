@@ -1,69 +1,244 @@
 package cobrautil
 
 import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
 	"fmt"
+	"io"
+	stdlog "log"
 	"net"
 	"net/http"
 	"os"
+	"path/filepath"
 	"runtime/debug"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/improbable-eng/grpc-web/go/grpcweb"
 	"github.com/jzelinskie/stringz"
-	"github.com/mattn/go-isatty"
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"github.com/rs/zerolog/pkgerrors"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"github.com/spf13/viper"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
 	"go.opentelemetry.io/otel/exporters/jaeger"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracegrpc"
 	"go.opentelemetry.io/otel/propagation"
 	"go.opentelemetry.io/otel/sdk/resource"
 	"go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
 	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/reflection"
+
+	"github.com/jzelinskie/cobrautil/internal/logflags"
 )
 
+// ShouldSkipPreRun is called by the PreRunEs in this package to determine
+// whether they should be a no-op for the command being run.
+//
+// It defaults to IsBuiltinCommand and can be replaced in order to skip
+// additional commands, such as a "version" command. It does not affect
+// slogutil.SlogPreRunE, which has its own slogutil.ShouldSkipPreRun.
+var ShouldSkipPreRun = IsBuiltinCommand
+
 // IsBuiltinCommand checks against a hard-coded list of the names of commands
-// that cobra provides out-of-the-box.
+// that cobra provides out-of-the-box, including the hidden commands used for
+// shell completion and the subcommands of "completion".
 func IsBuiltinCommand(cmd *cobra.Command) bool {
-	return stringz.SliceContains([]string{
-		"help [command]",
-		"completion [command]",
-	},
-		cmd.Use,
-	)
+	return logflags.IsBuiltinCommand(cmd)
 }
 
 // SyncViperPreRunE returns a Cobra run func that synchronizes Viper environment
 // flags prefixed with the provided argument.
 //
+// If the command has the flag added by RegisterConfigFileFlags(), values are
+// also read from the config file it names. Values are taken from the first of
+// the following that is set: the flag, the environment, the config file, and
+// finally the flag's default.
+//
+// The flags whose values were taken from the environment are recorded along
+// with the names of their environment variables; see AppliedEnvVars(). They
+// are logged at debug level by ZeroLogPreRunE once logging is configured.
+//
+// An error is returned if multiple flags would map to the same environment
+// variable, e.g. "foo-bar" and "foo_bar", or if an environment variable holds
+// a value that its flag rejects.
+//
 // Thanks to Carolyn Van Slyck: https://github.com/carolynvs/stingoftheviper
 func SyncViperPreRunE(prefix string) func(cmd *cobra.Command, args []string) error {
 	prefix = strings.ReplaceAll(strings.ToUpper(prefix), "-", "_")
 	return func(cmd *cobra.Command, args []string) error {
-		if IsBuiltinCommand(cmd) {
+		if ShouldSkipPreRun(cmd) {
 			return nil // No-op for builtins
 		}
 
+		if err := checkEnvCollisions(cmd, prefix); err != nil {
+			return err
+		}
+
 		v := viper.New()
 		viper.SetEnvPrefix(prefix)
 
 		cmd.Flags().VisitAll(func(f *pflag.Flag) {
-			suffix := strings.ToUpper(strings.ReplaceAll(f.Name, "-", "_"))
-			_ = v.BindEnv(f.Name, prefix+"_"+suffix)
+			_ = v.BindEnv(f.Name, envName(prefix, f.Name))
+		})
 
-			if !f.Changed && v.IsSet(f.Name) {
-				val := v.Get(f.Name)
-				_ = cmd.Flags().Set(f.Name, fmt.Sprintf("%v", val))
+		if err := readConfigFile(cmd, v); err != nil {
+			return err
+		}
+
+		var err error
+		applied := make(map[string]string)
+		cmd.Flags().VisitAll(func(f *pflag.Flag) {
+			if !f.Changed && v.IsSet(f.Name) && err == nil {
+				if setErr := cmd.Flags().Set(f.Name, flagValue(v.Get(f.Name))); setErr != nil {
+					err = fmt.Errorf("invalid value for --%s from $%s or config file: %w", f.Name, envName(prefix, f.Name), setErr)
+					return
+				}
+				if _, ok := os.LookupEnv(envName(prefix, f.Name)); ok {
+					applied[f.Name] = envName(prefix, f.Name)
+				}
 			}
 		})
+		if err != nil {
+			return err
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+		cmd.SetContext(context.WithValue(ctx, appliedEnvVarsKey{}, applied))
+		return nil
+	}
+}
+
+type appliedEnvVarsKey struct{}
+
+// AppliedEnvVars returns the flags that SyncViperPreRunE set from environment
+// variables, mapped to the names of those environment variables.
+func AppliedEnvVars(cmd *cobra.Command) map[string]string {
+	ctx := cmd.Context()
+	if ctx == nil {
+		return nil
+	}
+	applied, _ := ctx.Value(appliedEnvVarsKey{}).(map[string]string)
+	return applied
+}
+
+// logAppliedEnvVars logs the result of AppliedEnvVars() at debug level.
+func logAppliedEnvVars(cmd *cobra.Command) {
+	applied := AppliedEnvVars(cmd)
+	if len(applied) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(applied))
+	for name := range applied {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	flags := zerolog.Dict()
+	for _, name := range names {
+		flags.Str(name, applied[name])
+	}
+	log.Debug().Dict("flags", flags).Msg("applied flag values from environment variables")
+}
+
+// ConfigFileFlag is the name of the flag added by RegisterConfigFileFlags.
+const ConfigFileFlag = "config"
+
+// RegisterConfigFileFlags adds the following flags for use with
+// SyncViperPreRunE:
+// - "config"
+//
+// A config file at the default path is skipped if it does not exist, but one
+// that was explicitly provided must exist.
+func RegisterConfigFileFlags(flags *pflag.FlagSet, defaultPath string) {
+	flags.String(ConfigFileFlag, defaultPath, "path to a YAML or JSON config file whose keys are flag names")
+}
 
+// readConfigFile reads the config file named by the ConfigFileFlag into the
+// provided Viper, if the command has that flag.
+func readConfigFile(cmd *cobra.Command, v *viper.Viper) error {
+	f := cmd.Flags().Lookup(ConfigFileFlag)
+	if f == nil {
 		return nil
 	}
+
+	explicit := f.Changed || v.IsSet(f.Name)
+	path := f.Value.String()
+	if !f.Changed && v.IsSet(f.Name) {
+		path = v.GetString(f.Name)
+	}
+	if path == "" {
+		return nil
+	}
+
+	v.SetConfigFile(path)
+	if err := v.ReadInConfig(); err != nil {
+		if !explicit && errors.Is(err, os.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("failed to read config file: %w", err)
+	}
+	return nil
+}
+
+// flagValue formats a value from Viper such that it can be used to set a
+// flag.
+func flagValue(val interface{}) string {
+	if vals, ok := val.([]interface{}); ok {
+		strs := make([]string, 0, len(vals))
+		for _, v := range vals {
+			strs = append(strs, fmt.Sprintf("%v", v))
+		}
+		return strings.Join(strs, ",")
+	}
+	return fmt.Sprintf("%v", val)
+}
+
+// envName returns the name of the environment variable that is synchronized
+// with the provided flag.
+func envName(prefix, flagName string) string {
+	return prefix + "_" + strings.ToUpper(strings.ReplaceAll(flagName, "-", "_"))
+}
+
+// checkEnvCollisions returns an error if multiple flags would be synchronized
+// with the same environment variable.
+func checkEnvCollisions(cmd *cobra.Command, prefix string) error {
+	var collisions []string
+	seen := make(map[string]string)
+	cmd.Flags().VisitAll(func(f *pflag.Flag) {
+		name := envName(prefix, f.Name)
+		if existing, ok := seen[name]; ok {
+			collisions = append(collisions, fmt.Sprintf("%s (--%s, --%s)", name, existing, f.Name))
+			return
+		}
+		seen[name] = f.Name
+	})
+
+	if len(collisions) > 0 {
+		return fmt.Errorf("multiple flags map to the same environment variable: %s", strings.Join(collisions, ", "))
+	}
+	return nil
 }
 
 // CobraRunFunc is the signature of cobra.Command RunFuncs.
@@ -81,33 +256,191 @@ func CommandStack(cmdfns ...CobraRunFunc) CobraRunFunc {
 	}
 }
 
+// Teardown is a function that releases what was set up by a ContextRunFunc.
+type Teardown func(ctx context.Context) error
+
+// ContextRunFunc is a stage of CommandStackWithContext that can optionally
+// return a Teardown to undo its work.
+type ContextRunFunc func(ctx context.Context, cmd *cobra.Command, args []string) (Teardown, error)
+
+// WithoutTeardown adapts a CobraRunFunc for use with CommandStackWithContext.
+func WithoutTeardown(fn CobraRunFunc) ContextRunFunc {
+	return func(ctx context.Context, cmd *cobra.Command, args []string) (Teardown, error) {
+		return nil, fn(cmd, args)
+	}
+}
+
+// CommandStackWithContext chains together a collection of ContextRunFuncs
+// into one, passing each the context of the command.
+//
+// If a stage fails, the teardowns returned by the preceding stages are run in
+// reverse order and their errors are joined with the original error.
+// Otherwise, the teardowns are registered with RegisterCloser() so that they
+// are run by CloseAll().
+func CommandStackWithContext(cmdfns ...ContextRunFunc) CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		var teardowns []Teardown
+		for _, cmdfn := range cmdfns {
+			teardown, err := cmdfn(ctx, cmd, args)
+			if err != nil {
+				errs := []error{err}
+				for i := len(teardowns) - 1; i >= 0; i-- {
+					errs = append(errs, teardowns[i](ctx))
+				}
+				return errors.Join(errs...)
+			}
+			if teardown != nil {
+				teardowns = append(teardowns, teardown)
+			}
+		}
+
+		for _, teardown := range teardowns {
+			RegisterCloser(cmd, teardownCloser(teardown))
+		}
+		return nil
+	}
+}
+
+// teardownCloser adapts a Teardown into an io.Closer.
+type teardownCloser Teardown
+
+func (t teardownCloser) Close() error { return t(context.Background()) }
+
+// ValidateFlagShorthands returns an error describing every flag shorthand
+// claimed by more than one flag on the provided command or its descendants,
+// including flags inherited from parent commands.
+//
+// This is intended to be called from tests: when a command inherits a flag
+// whose shorthand collides with one of its own, cobra panics while merging
+// their flags, before any PreRunE is run.
+func ValidateFlagShorthands(cmd *cobra.Command) error {
+	var collisions []string
+	validateFlagShorthands(cmd, &collisions)
+	if len(collisions) > 0 {
+		return fmt.Errorf("duplicate flag shorthands: %s", strings.Join(collisions, "; "))
+	}
+	return nil
+}
+
+func validateFlagShorthands(cmd *cobra.Command, collisions *[]string) {
+	owners := make(map[string]string)
+	visit := func(f *pflag.Flag) {
+		if f.Shorthand == "" {
+			return
+		}
+		if owner, ok := owners[f.Shorthand]; ok && owner != f.Name {
+			*collisions = append(*collisions, fmt.Sprintf(
+				"%s: -%s is used by both --%s and --%s",
+				cmd.CommandPath(),
+				f.Shorthand,
+				owner,
+				f.Name,
+			))
+			return
+		}
+		owners[f.Shorthand] = f.Name
+	}
+
+	cmd.Flags().VisitAll(visit)
+	cmd.PersistentFlags().VisitAll(visit)
+	for parent := cmd.Parent(); parent != nil; parent = parent.Parent() {
+		parent.PersistentFlags().VisitAll(visit)
+	}
+
+	for _, child := range cmd.Commands() {
+		validateFlagShorthands(child, collisions)
+	}
+}
+
 // RegisterZeroLogFlags adds flags for use in with ZeroLogPreRunE:
 // - "$PREFIX-level"
 // - "$PREFIX-format"
+// - "$PREFIX-output"
+// - "$PREFIX-max-size"
+// - "$PREFIX-max-backups"
+// - "$PREFIX-max-age"
+// - "$PREFIX-caller"
+// - "$PREFIX-stacktrace"
 func RegisterZeroLogFlags(flags *pflag.FlagSet, flagPrefix string) {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "log")
-	flags.String(flagPrefix+"-level", "info", `verbosity of logging ("trace", "debug", "info", "warn", "error")`)
-	flags.String(flagPrefix+"-format", "auto", `format of logs ("auto", "human", "json")`)
+	registerPrefix(flagPrefix, "log")
+	RegisterEnumFlag(flags, flagPrefix+"-level", "info", "verbosity of logging", logflags.Levels...)
+	RegisterEnumFlag(flags, flagPrefix+"-format", "auto", "format of logs", logflags.Formats...)
+	logflags.RegisterOutputFlags(flags, flagPrefix)
+	flags.Bool(flagPrefix+"-caller", false, "include the file and line that emitted each log")
+	flags.Bool(flagPrefix+"-stacktrace", false, "include stack traces of errors that carry one")
+}
+
+// ConsoleWriterOption customizes the zerolog.ConsoleWriter used by
+// ZeroLogPreRunE for human-readable logs.
+type ConsoleWriterOption func(*zerolog.ConsoleWriter)
+
+// WithConsolePartsOrder sets the order in which the parts of a log, such as
+// zerolog.TimestampFieldName and zerolog.MessageFieldName, are written.
+func WithConsolePartsOrder(parts ...string) ConsoleWriterOption {
+	return func(w *zerolog.ConsoleWriter) {
+		w.PartsOrder = parts
+	}
+}
+
+// WithConsoleFieldsOrder sets the fields that are written first, in order,
+// before the remaining fields of a log.
+func WithConsoleFieldsOrder(fields ...string) ConsoleWriterOption {
+	return func(w *zerolog.ConsoleWriter) {
+		w.FieldsOrder = fields
+	}
 }
 
 // ZeroLogPreRunE returns a Cobra run func that configures the corresponding
 // log level from a command.
 //
+// The provided options are applied to the console writer used for
+// human-readable logs.
+//
 // The required flags can be added to a command by using
 // RegisterLoggingPersistentFlags().
-func ZeroLogPreRunE(flagPrefix string, prerunLevel zerolog.Level) CobraRunFunc {
+func ZeroLogPreRunE(flagPrefix string, prerunLevel zerolog.Level, opts ...ConsoleWriterOption) CobraRunFunc {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "log")
 	return func(cmd *cobra.Command, args []string) error {
-		if IsBuiltinCommand(cmd) {
+		if ShouldSkipPreRun(cmd) {
 			return nil // No-op for builtins
 		}
 
-		format := MustGetString(cmd, flagPrefix+"-format")
-		if format == "human" || (format == "auto" && isatty.IsTerminal(os.Stdout.Fd())) {
-			log.Logger = log.Output(zerolog.ConsoleWriter{Out: os.Stdout})
+		format := MustGetEnum(cmd, flagPrefix+"-format")
+		output, human, err := logOutputFromFlags(cmd, flagPrefix, format)
+		if err != nil {
+			return err
+		}
+
+		var w io.Writer = output
+		switch {
+		case format == "gcp":
+			zerolog.LevelFieldName = "severity"
+			zerolog.LevelFieldMarshalFunc = gcpSeverity
+		case human:
+			cw := zerolog.ConsoleWriter{Out: output}
+			for _, opt := range opts {
+				opt(&cw)
+			}
+			w = cw
+		}
+		logger := log.Output(w)
+		if MustGetBool(cmd, flagPrefix+"-caller") {
+			zerolog.CallerMarshalFunc = trimCaller
+			logger = logger.With().Caller().Logger()
+		}
+		if MustGetBool(cmd, flagPrefix+"-stacktrace") {
+			zerolog.ErrorStackMarshaler = pkgerrors.MarshalStack
+			logger = logger.With().Stack().Logger()
 		}
+		log.Logger = logger
 
-		level := strings.ToLower(MustGetString(cmd, flagPrefix+"-level"))
+		level := MustGetEnum(cmd, flagPrefix+"-level")
 		switch level {
 		case "trace":
 			zerolog.SetGlobalLevel(zerolog.TraceLevel)
@@ -128,23 +461,87 @@ func ZeroLogPreRunE(flagPrefix string, prerunLevel zerolog.Level) CobraRunFunc {
 		}
 
 		log.WithLevel(prerunLevel).Str("new level", level).Msg("set log level")
+		logAppliedEnvVars(cmd)
 		return nil
 	}
 }
 
+// trimCaller formats the caller of a log as its file's parent directory, file
+// name, and line rather than the file's absolute path.
+func trimCaller(pc uintptr, file string, line int) string {
+	dir, name := filepath.Split(file)
+	return filepath.Join(filepath.Base(dir), name) + ":" + strconv.Itoa(line)
+}
+
+// logOutputFromFlags opens the destination of logs named by the
+// "$PREFIX-output" flag, rotating files as configured by the "$PREFIX-max-*"
+// flags, and reports whether logs in the provided format should be
+// human-readable.
+//
+// The destination is registered with RegisterCloser() so that files are
+// closed by CloseAll().
+func logOutputFromFlags(cmd *cobra.Command, flagPrefix, format string) (io.Writer, bool, error) {
+	output, human, err := logflags.OutputFromFlags(cmd.Flags(), flagPrefix, format)
+	if err != nil {
+		return nil, false, err
+	}
+	RegisterCloser(cmd, output)
+	return output, human, nil
+}
+
+// gcpSeverity maps zerolog levels to the severity values understood by
+// Google Cloud Logging.
+//
+// For low-level details see:
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogSeverity
+func gcpSeverity(l zerolog.Level) string {
+	return logflags.GcpSeverity(l.String())
+}
+
 // RegisterOpenTelemetryFlags adds the following flags for use with
 // OpenTelemetryPreRunE:
 // - "$PREFIX-provider"
 // - "$PREFIX-jaeger-endpoint"
 // - "$PREFIX-jaeger-service-name"
+// - "$PREFIX-jaeger-username"
+// - "$PREFIX-jaeger-password"
+// - "$PREFIX-otlp-endpoint"
+// - "$PREFIX-otlp-insecure"
+// - "$PREFIX-otlp-service-name"
+// - "$PREFIX-otlp-retry-enabled"
+// - "$PREFIX-otlp-retry-initial-interval"
+// - "$PREFIX-otlp-retry-max-interval"
+// - "$PREFIX-otlp-retry-max-elapsed-time"
+// - "$PREFIX-fallback-endpoint"
+// - "$PREFIX-propagators"
+// - "$PREFIX-sample-ratio"
+// - "$PREFIX-max-attributes"
+// - "$PREFIX-max-events"
+// - "$PREFIX-max-links"
 func RegisterOpenTelemetryFlags(flags *pflag.FlagSet, flagPrefix, serviceName string) {
 	bi, _ := debug.ReadBuildInfo()
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "otel")
 	serviceName = stringz.DefaultEmpty(serviceName, bi.Main.Path)
+	registerPrefix(flagPrefix, "otel")
 
-	flags.String(flagPrefix+"-provider", "none", `opentelemetry provider for tracing ("none", "jaeger")`)
+	RegisterEnumFlag(flags, flagPrefix+"-provider", "none", "opentelemetry provider for tracing", "none", "jaeger", "otlp")
 	flags.String(flagPrefix+"-jaeger-endpoint", "http://jaeger:14268/api/traces", "jaeger collector endpoint")
 	flags.String(flagPrefix+"-jaeger-service-name", serviceName, "jaeger service name for trace data")
+	flags.String(flagPrefix+"-jaeger-username", "", "username used to authenticate with the jaeger collector")
+	flags.String(flagPrefix+"-jaeger-password", "", "password used to authenticate with the jaeger collector")
+	flags.String(flagPrefix+"-otlp-endpoint", "localhost:4317", "otlp collector gRPC endpoint")
+	flags.Bool(flagPrefix+"-otlp-insecure", false, "connect to the otlp collector in plaintext")
+	flags.String(flagPrefix+"-otlp-service-name", serviceName, "otlp service name for trace data")
+	flags.Bool(flagPrefix+"-otlp-retry-enabled", true, "retry exporting trace data after transient otlp collector errors")
+	flags.Duration(flagPrefix+"-otlp-retry-initial-interval", 5*time.Second, "how long to wait before the first retry of a failed otlp export")
+	flags.Duration(flagPrefix+"-otlp-retry-max-interval", 30*time.Second, "maximum time to wait between retries of a failed otlp export")
+	flags.Duration(flagPrefix+"-otlp-retry-max-elapsed-time", time.Minute, "maximum time spent retrying a failed otlp export before dropping it")
+	flags.String(flagPrefix+"-fallback-endpoint", "", "collector endpoint for the selected provider used when exporting to the primary endpoint fails")
+	flags.StringSlice(flagPrefix+"-propagators", []string{"tracecontext"}, `opentelemetry propagators for contexts across services ("tracecontext", "baggage")`)
+	flags.Float64(flagPrefix+"-sample-ratio", 1.0, "ratio of traces that are sampled, from 0 to 1")
+	flags.Int(flagPrefix+"-max-attributes", trace.DefaultAttributeCountLimit, "maximum number of attributes recorded per span")
+	flags.Int(flagPrefix+"-max-events", trace.DefaultEventCountLimit, "maximum number of events recorded per span")
+	flags.Int(flagPrefix+"-max-links", trace.DefaultLinkCountLimit, "maximum number of links recorded per span")
 }
 
 // OpenTelemetryPreRunE returns a Cobra run func that configures the
@@ -155,19 +552,47 @@ func RegisterOpenTelemetryFlags(flags *pflag.FlagSet, flagPrefix, serviceName st
 func OpenTelemetryPreRunE(flagPrefix string, prerunLevel zerolog.Level) CobraRunFunc {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "otel")
 	return func(cmd *cobra.Command, args []string) error {
-		if IsBuiltinCommand(cmd) {
+		if ShouldSkipPreRun(cmd) {
 			return nil // No-op for builtins
 		}
 
-		provider := strings.ToLower(MustGetString(cmd, flagPrefix+"-provider"))
+		provider := MustGetEnum(cmd, flagPrefix+"-provider")
 		switch provider {
 		case "none":
 			// Nothing.
 		case "jaeger":
-			return initJaegerTracer(
+			username := MustGetStringExpanded(cmd, flagPrefix+"-jaeger-username")
+			password := MustGetStringExpanded(cmd, flagPrefix+"-jaeger-password")
+			if err := initTracer(
+				cmd,
+				flagPrefix,
+				flagPrefix+"-jaeger-service-name",
 				MustGetString(cmd, flagPrefix+"-jaeger-endpoint"),
-				MustGetString(cmd, flagPrefix+"-jaeger-service-name"),
-			)
+				func(endpoint string) (trace.SpanExporter, error) {
+					return newJaegerExporter(endpoint, username, password)
+				},
+			); err != nil {
+				return err
+			}
+		case "otlp":
+			insecure := MustGetBool(cmd, flagPrefix+"-otlp-insecure")
+			retry := otlptracegrpc.RetryConfig{
+				Enabled:         MustGetBool(cmd, flagPrefix+"-otlp-retry-enabled"),
+				InitialInterval: MustGetDuration(cmd, flagPrefix+"-otlp-retry-initial-interval"),
+				MaxInterval:     MustGetDuration(cmd, flagPrefix+"-otlp-retry-max-interval"),
+				MaxElapsedTime:  MustGetDuration(cmd, flagPrefix+"-otlp-retry-max-elapsed-time"),
+			}
+			if err := initTracer(
+				cmd,
+				flagPrefix,
+				flagPrefix+"-otlp-service-name",
+				MustGetStringExpanded(cmd, flagPrefix+"-otlp-endpoint"),
+				func(endpoint string) (trace.SpanExporter, error) {
+					return newOtlpExporter(endpoint, insecure, retry)
+				},
+			); err != nil {
+				return err
+			}
 		default:
 			return fmt.Errorf("unknown tracing provider: %s", provider)
 		}
@@ -177,151 +602,1056 @@ func OpenTelemetryPreRunE(flagPrefix string, prerunLevel zerolog.Level) CobraRun
 	}
 }
 
-func initJaegerTracer(endpoint, serviceName string) error {
-	exp, err := jaeger.New(jaeger.WithCollectorEndpoint(jaeger.WithEndpoint(endpoint)))
+// TracedRunE wraps the provided run func in a span named after the command
+// path, recording any error it returns.
+//
+// The span's context is set on the command so that spans started from
+// cmd.Context() are its children. The global tracer should already be
+// configured, e.g. by OpenTelemetryPreRunE().
+func TracedRunE(fn CobraRunFunc) CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		ctx, span := otel.Tracer("github.com/jzelinskie/cobrautil").Start(cmd.Context(), cmd.CommandPath())
+		defer span.End()
+		cmd.SetContext(ctx)
+
+		err := fn(cmd, args)
+		if err != nil {
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		return err
+	}
+}
+
+// tracerConfig is the configuration shared by the global tracer for every
+// provider.
+type tracerConfig struct {
+	serviceName string
+	sampler     trace.Sampler
+	limits      trace.SpanLimits
+	propagator  propagation.TextMapPropagator
+}
+
+// tracerConfigFromFlags returns the tracerConfig stored in the cobra command
+// that was registered with RegisterOpenTelemetryFlags.
+func tracerConfigFromFlags(cmd *cobra.Command, flagPrefix, serviceNameFlag string) (tracerConfig, error) {
+	propagator, err := propagatorFromFlags(cmd, flagPrefix)
+	if err != nil {
+		return tracerConfig{}, err
+	}
+
+	ratio := MustGetFloat64(cmd, flagPrefix+"-sample-ratio")
+	if ratio < 0 || ratio > 1 {
+		return tracerConfig{}, fmt.Errorf("invalid tracing sample ratio: %v is not between 0 and 1", ratio)
+	}
+
+	return tracerConfig{
+		serviceName: MustGetString(cmd, serviceNameFlag),
+		sampler:     trace.ParentBased(trace.TraceIDRatioBased(ratio)),
+		limits:      spanLimitsFromFlags(cmd, flagPrefix),
+		propagator:  propagator,
+	}, nil
+}
+
+// propagatorFromFlags composes the propagators named by the
+// "$PREFIX-propagators" flag into a single TextMapPropagator.
+func propagatorFromFlags(cmd *cobra.Command, flagPrefix string) (propagation.TextMapPropagator, error) {
+	var propagators []propagation.TextMapPropagator
+	for _, name := range MustGetStringSlice(cmd, flagPrefix+"-propagators") {
+		switch strings.ToLower(name) {
+		case "tracecontext":
+			// Use the W3C method for propagating contexts across services.
+			//
+			// For low-level details see:
+			// https://www.w3.org/TR/trace-context/
+			propagators = append(propagators, propagation.TraceContext{})
+		case "baggage":
+			// Use the W3C method for propagating arbitrary key-values across
+			// services.
+			//
+			// For low-level details see:
+			// https://www.w3.org/TR/baggage/
+			propagators = append(propagators, propagation.Baggage{})
+		default:
+			return nil, fmt.Errorf("unknown tracing propagator: %s", name)
+		}
+	}
+	return propagation.NewCompositeTextMapPropagator(propagators...), nil
+}
+
+// spanLimitsFromFlags returns the trace.SpanLimits configured by the
+// "$PREFIX-max-*" flags.
+func spanLimitsFromFlags(cmd *cobra.Command, flagPrefix string) trace.SpanLimits {
+	return trace.SpanLimits{
+		AttributeCountLimit:         MustGetInt(cmd, flagPrefix+"-max-attributes"),
+		EventCountLimit:             MustGetInt(cmd, flagPrefix+"-max-events"),
+		LinkCountLimit:              MustGetInt(cmd, flagPrefix+"-max-links"),
+		AttributePerEventCountLimit: trace.DefaultAttributePerEventCountLimit,
+		AttributePerLinkCountLimit:  trace.DefaultAttributePerLinkCountLimit,
+	}
+}
+
+// initTracer configures the global tracer to export to the provided endpoint,
+// failing over to "$PREFIX-fallback-endpoint" if it is set.
+//
+// If only one of the endpoints can be connected to at startup, spans are
+// exported to it alone.
+func initTracer(cmd *cobra.Command, flagPrefix, serviceNameFlag, endpoint string, newExporter func(endpoint string) (trace.SpanExporter, error)) error {
+	cfg, err := tracerConfigFromFlags(cmd, flagPrefix, serviceNameFlag)
+	if err != nil {
+		return err
+	}
+
+	exp, err := newFailoverExporter(endpoint, MustGetStringExpanded(cmd, flagPrefix+"-fallback-endpoint"), newExporter)
 	if err != nil {
 		return err
 	}
 
-	// Configure the global tracer as a batched, always sampling Jaeger exporter.
-	otel.SetTracerProvider(trace.NewTracerProvider(
-		trace.WithSampler(trace.AlwaysSample()),
-		trace.WithSpanProcessor(trace.NewBatchSpanProcessor(exp)),
-		trace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(serviceName))),
-	))
-
-	// Configure the global tracer to use the W3C method for propagating contexts
-	// across services.
-	//
-	// For low-level details see:
-	// https://www.w3.org/TR/trace-context/
-	otel.SetTextMapPropagator(propagation.TraceContext{})
+	setGlobalTracer(exp, cfg)
 	return nil
 }
 
+// newFailoverExporter creates an exporter for the primary endpoint that fails
+// over to the fallback endpoint, if one is provided.
+func newFailoverExporter(endpoint, fallbackEndpoint string, newExporter func(endpoint string) (trace.SpanExporter, error)) (trace.SpanExporter, error) {
+	primary, primaryErr := newExporter(endpoint)
+	if fallbackEndpoint == "" {
+		return primary, primaryErr
+	}
+
+	fallback, fallbackErr := newExporter(fallbackEndpoint)
+	switch {
+	case primaryErr != nil && fallbackErr != nil:
+		return nil, fmt.Errorf("failed to create exporters for primary (%s) and fallback endpoints: %w", primaryErr, fallbackErr)
+	case primaryErr != nil:
+		log.Warn().Err(primaryErr).Str("endpoint", endpoint).Msg("failed to create exporter for primary endpoint; using fallback")
+		return fallback, nil
+	case fallbackErr != nil:
+		log.Warn().Err(fallbackErr).Str("endpoint", fallbackEndpoint).Msg("failed to create exporter for fallback endpoint; using primary")
+		return primary, nil
+	default:
+		return &failoverExporter{primary: primary, fallback: fallback}, nil
+	}
+}
+
+func newJaegerExporter(endpoint, username, password string) (trace.SpanExporter, error) {
+	opts := []jaeger.CollectorEndpointOption{jaeger.WithEndpoint(endpoint)}
+	if username != "" {
+		opts = append(opts, jaeger.WithUsername(username))
+	}
+	if password != "" {
+		opts = append(opts, jaeger.WithPassword(password))
+	}
+
+	return jaeger.New(jaeger.WithCollectorEndpoint(opts...))
+}
+
+// otlpConnectTimeout is how long to wait for the OTLP collector to become
+// reachable before giving up.
+const otlpConnectTimeout = 10 * time.Second
+
+func newOtlpExporter(endpoint string, insecure bool, retry otlptracegrpc.RetryConfig) (trace.SpanExporter, error) {
+	var dialOpt grpc.DialOption
+	var clientOpts []otlptracegrpc.Option
+	if insecure {
+		dialOpt = grpc.WithInsecure()
+		clientOpts = append(clientOpts, otlptracegrpc.WithInsecure())
+	} else {
+		creds := credentials.NewClientTLSFromCert(nil, "")
+		dialOpt = grpc.WithTransportCredentials(creds)
+		clientOpts = append(clientOpts, otlptracegrpc.WithTLSCredentials(creds))
+	}
+	clientOpts = append(clientOpts, otlptracegrpc.WithEndpoint(endpoint), otlptracegrpc.WithRetry(retry))
+
+	// The exporter connects in the background and drops spans until it
+	// succeeds, so check that the collector is reachable up front.
+	ctx, cancel := context.WithTimeout(context.Background(), otlpConnectTimeout)
+	defer cancel()
+	if err := WaitForGrpcReady(ctx, endpoint, dialOpt); err != nil {
+		return nil, fmt.Errorf("failed to connect to otlp collector: %w", err)
+	}
+
+	return otlptracegrpc.New(context.Background(), clientOpts...)
+}
+
+// failoverExporter is a trace.SpanExporter that exports spans to a fallback
+// exporter when they fail to export to the primary exporter.
+type failoverExporter struct {
+	primary  trace.SpanExporter
+	fallback trace.SpanExporter
+}
+
+var _ trace.SpanExporter = (*failoverExporter)(nil)
+
+func (e *failoverExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	// The primary exporter may retry until its context expires, so give it
+	// only half of the remaining time so that the fallback has the rest.
+	primaryCtx := ctx
+	if deadline, ok := ctx.Deadline(); ok {
+		var cancel context.CancelFunc
+		primaryCtx, cancel = context.WithTimeout(ctx, time.Until(deadline)/2)
+		defer cancel()
+	}
+
+	err := e.primary.ExportSpans(primaryCtx, spans)
+	if err == nil {
+		return nil
+	}
+
+	log.Debug().Err(err).Msg("failed to export spans to primary endpoint; trying fallback")
+	if fallbackErr := e.fallback.ExportSpans(ctx, spans); fallbackErr != nil {
+		return fmt.Errorf("failed to export spans to primary (%s) and fallback endpoints: %w", err, fallbackErr)
+	}
+	return nil
+}
+
+func (e *failoverExporter) Shutdown(ctx context.Context) error {
+	primaryErr := e.primary.Shutdown(ctx)
+	if err := e.fallback.Shutdown(ctx); err != nil {
+		return err
+	}
+	return primaryErr
+}
+
+// tracerProvider is the tracer provider installed by setGlobalTracer, kept so
+// that OpenTelemetryShutdown can flush it.
+var (
+	tracerProviderMu sync.Mutex
+	tracerProvider   *trace.TracerProvider
+)
+
+// OpenTelemetryShutdown flushes any buffered spans and shuts down the tracer
+// provider configured by OpenTelemetryPreRunE.
+//
+// It is safe to call more than once and is a no-op if no tracer provider was
+// configured, such as when the provider was "none".
+func OpenTelemetryShutdown(ctx context.Context) error {
+	tracerProviderMu.Lock()
+	tp := tracerProvider
+	tracerProvider = nil
+	tracerProviderMu.Unlock()
+
+	if tp == nil {
+		return nil
+	}
+	if err := tp.Shutdown(ctx); err != nil {
+		return fmt.Errorf("failed to shutdown tracer provider: %w", err)
+	}
+	return nil
+}
+
+// setGlobalTracer configures the global tracer to export to the provided
+// exporter.
+func setGlobalTracer(exp trace.SpanExporter, cfg tracerConfig) {
+	// Configure the global tracer as a batched exporter that respects the
+	// sampling decisions of parent spans and otherwise samples at the
+	// configured ratio.
+	tp := trace.NewTracerProvider(
+		trace.WithSampler(cfg.sampler),
+		trace.WithSpanProcessor(trace.NewBatchSpanProcessor(exp)),
+		trace.WithSpanLimits(cfg.limits),
+		trace.WithResource(resource.NewSchemaless(semconv.ServiceNameKey.String(cfg.serviceName))),
+	)
+	otel.SetTracerProvider(tp)
+
+	tracerProviderMu.Lock()
+	tracerProvider = tp
+	tracerProviderMu.Unlock()
+
+	// Configure the global tracer to propagate contexts across services using
+	// the configured propagators.
+	otel.SetTextMapPropagator(cfg.propagator)
+}
+
 // RegisterGrpcServerFlags adds the following flags for use with
 // GrpcServerFromFlags:
 // - "$PREFIX-addr"
 // - "$PREFIX-tls-cert-path"
 // - "$PREFIX-tls-key-path"
+// - "$PREFIX-tls-client-ca-path"
+// - "$PREFIX-tls-allowed-cns"
+// - "$PREFIX-tls-crl-path"
+// - "$PREFIX-tls-session-tickets"
+// - "$PREFIX-tls-insecure"
 // - "$PREFIX-max-conn-age"
+// - "$PREFIX-max-conn-age-grace"
+// - "$PREFIX-keepalive-time"
+// - "$PREFIX-keepalive-timeout"
+// - "$PREFIX-min-client-ping-interval"
+// - "$PREFIX-permit-keepalive-without-stream"
+// - "$PREFIX-enabled"
+// - "$PREFIX-health-enabled"
+// - "$PREFIX-reflection-enabled"
 func RegisterGrpcServerFlags(flags *pflag.FlagSet, flagPrefix, serviceName, defaultAddr string, defaultEnabled bool) {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "grpc")
 	serviceName = stringz.DefaultEmpty(serviceName, "grpc")
 	defaultAddr = stringz.DefaultEmpty(defaultAddr, ":50051")
+	registerPrefix(flagPrefix, "grpc")
 
 	flags.String(flagPrefix+"-addr", defaultAddr, "address to listen on to serve "+serviceName)
 	flags.String(flagPrefix+"-tls-cert-path", "", "local path to the TLS certificate used to serve "+serviceName)
 	flags.String(flagPrefix+"-tls-key-path", "", "local path to the TLS key used to serve "+serviceName)
+	flags.String(flagPrefix+"-tls-client-ca-path", "", "local path to the CA bundle used to verify client certificates connecting to "+serviceName)
+	flags.StringSlice(flagPrefix+"-tls-allowed-cns", nil, "common names or DNS SANs of the client certificates allowed to connect to "+serviceName+" (all verified clients if empty)")
+	flags.String(flagPrefix+"-tls-crl-path", "", "local path to the PEM or DER certificate revocation lists used to reject revoked client certificates connecting to "+serviceName)
+	flags.Bool(flagPrefix+"-tls-session-tickets", true, "enable TLS session ticket resumption for connections serving "+serviceName)
+	flags.Bool(flagPrefix+"-tls-insecure", false, "serve "+serviceName+" in plaintext when no TLS certificate and key are provided")
 	flags.Duration(flagPrefix+"-max-conn-age", 30*time.Second, "how long a connection serving "+serviceName+" should be able to live")
+	flags.Duration(flagPrefix+"-max-conn-age-grace", 0, "how long a connection serving "+serviceName+" has to finish in-flight RPCs after reaching its max age (0 waits forever)")
+	flags.Duration(flagPrefix+"-keepalive-time", 2*time.Hour, "how long a connection serving "+serviceName+" can be idle before it is pinged")
+	flags.Duration(flagPrefix+"-keepalive-timeout", 20*time.Second, "how long to wait for a response to a keepalive ping before closing a connection serving "+serviceName)
+	flags.Duration(flagPrefix+"-min-client-ping-interval", 5*time.Minute, "minimum interval clients of "+serviceName+" are allowed to send keepalive pings")
+	flags.Bool(flagPrefix+"-permit-keepalive-without-stream", false, "allow clients of "+serviceName+" to send keepalive pings without active streams")
 	flags.Bool(flagPrefix+"-enabled", defaultEnabled, "enable "+serviceName+" gRPC server")
+	flags.Bool(flagPrefix+"-health-enabled", true, "enable the gRPC health service for "+serviceName)
+	flags.Bool(flagPrefix+"-reflection-enabled", true, "enable the gRPC reflection service for "+serviceName)
 }
 
 // GrpcServerFromFlags creates an *grpc.Server as configured by the flags from
 // RegisterGrpcServerFlags().
+//
+// Serving plaintext requires "$PREFIX-tls-insecure" to be set; otherwise an
+// error is returned if no TLS certificate and key are provided.
 func GrpcServerFromFlags(cmd *cobra.Command, flagPrefix string, opts ...grpc.ServerOption) (*grpc.Server, error) {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "grpc")
-	opts = append(opts, grpc.KeepaliveParams(keepalive.ServerParameters{
-		MaxConnectionAge: MustGetDuration(cmd, flagPrefix+"-max-conn-age"),
-	}))
+	opts = append(opts,
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionAge:      MustGetDuration(cmd, flagPrefix+"-max-conn-age"),
+			MaxConnectionAgeGrace: MustGetDuration(cmd, flagPrefix+"-max-conn-age-grace"),
+			Time:                  MustGetDuration(cmd, flagPrefix+"-keepalive-time"),
+			Timeout:               MustGetDuration(cmd, flagPrefix+"-keepalive-timeout"),
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             MustGetDuration(cmd, flagPrefix+"-min-client-ping-interval"),
+			PermitWithoutStream: MustGetBool(cmd, flagPrefix+"-permit-keepalive-without-stream"),
+		}),
+	)
 
-	certPath := MustGetStringExpanded(cmd, flagPrefix+"-tls-cert-path")
-	keyPath := MustGetStringExpanded(cmd, flagPrefix+"-tls-key-path")
+	certPath, keyPath, err := tlsPathsFromFlags(cmd, flagPrefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start gRPC server: %w", err)
+	}
+
+	clientCAPath := MustGetStringExpanded(cmd, flagPrefix+"-tls-client-ca-path")
+	allowedCNs := MustGetStringSlice(cmd, flagPrefix+"-tls-allowed-cns")
+	crlPath := MustGetStringExpanded(cmd, flagPrefix+"-tls-crl-path")
+	insecure := MustGetBool(cmd, flagPrefix+"-tls-insecure")
 
 	switch {
+	case clientCAPath == "" && len(allowedCNs) > 0:
+		return nil, fmt.Errorf(
+			"failed to start gRPC server: must provide --%s-tls-client-ca-path to use --%s-tls-allowed-cns",
+			flagPrefix,
+			flagPrefix,
+		)
+	case clientCAPath == "" && crlPath != "":
+		return nil, fmt.Errorf(
+			"failed to start gRPC server: must provide --%s-tls-client-ca-path to use --%s-tls-crl-path",
+			flagPrefix,
+			flagPrefix,
+		)
+	case certPath == "" && keyPath == "" && clientCAPath != "":
+		return nil, fmt.Errorf(
+			"failed to start gRPC server: must provide --%s-tls-cert-path and --%s-tls-key-path to use --%s-tls-client-ca-path",
+			flagPrefix,
+			flagPrefix,
+			flagPrefix,
+		)
+	case certPath == "" && keyPath == "" && !insecure:
+		return nil, fmt.Errorf(
+			"failed to start gRPC server: must provide --%s-tls-cert-path and --%s-tls-key-path or explicitly allow plaintext with --%s-tls-insecure",
+			flagPrefix,
+			flagPrefix,
+			flagPrefix,
+		)
 	case certPath == "" && keyPath == "":
-		log.Warn().Str("prefix", flagPrefix).Msg("grpc server serving plaintext")
-		return grpc.NewServer(opts...), nil
-	case certPath != "" && keyPath != "":
-		creds, err := credentials.NewServerTLSFromFile(certPath, keyPath)
-		if err != nil {
-			return nil, err
+		if _, warned := grpcPlaintextWarned.LoadOrStore(flagPrefix, struct{}{}); !warned {
+			log.Warn().Str("prefix", flagPrefix).Msg("grpc server serving plaintext")
 		}
-		opts = append(opts, grpc.Creds(creds))
-		return grpc.NewServer(opts...), nil
-	default:
+	case insecure:
 		return nil, fmt.Errorf(
-			"failed to start gRPC server: must provide both --%s-tls-cert-path and --%s-tls-key-path",
+			"failed to start gRPC server: --%s-tls-insecure cannot be used with --%s-tls-cert-path and --%s-tls-key-path",
+			flagPrefix,
+			flagPrefix,
+			flagPrefix,
+		)
+	default:
+		cert, err := loadKeyPair(flagPrefix, certPath, keyPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to start gRPC server: %w", err)
+		}
+		tlsConfig := &tls.Config{
+			Certificates:           []tls.Certificate{cert},
+			SessionTicketsDisabled: !MustGetBool(cmd, flagPrefix+"-tls-session-tickets"),
+		}
+
+		if clientCAPath != "" {
+			pool, err := certPoolFromFile(clientCAPath)
+			if err != nil {
+				return nil, fmt.Errorf("failed to start gRPC server: %w", err)
+			}
+			tlsConfig.ClientCAs = pool
+			tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+
+			var verifiers []func([][]byte, [][]*x509.Certificate) error
+			if crlPath != "" {
+				crls, err := crlsFromFile(crlPath)
+				if err != nil {
+					return nil, fmt.Errorf("failed to start gRPC server: %w", err)
+				}
+				verifiers = append(verifiers, verifyNotRevoked(crls))
+			}
+			if len(allowedCNs) > 0 {
+				verifiers = append(verifiers, verifyAllowedCNs(allowedCNs))
+			}
+			if len(verifiers) > 0 {
+				tlsConfig.VerifyPeerCertificate = verifyAll(verifiers...)
+			}
+		}
+
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+
+	srv := grpc.NewServer(opts...)
+	if MustGetBool(cmd, flagPrefix+"-health-enabled") {
+		registerGrpcHealth(srv)
+	}
+	if MustGetBool(cmd, flagPrefix+"-reflection-enabled") {
+		reflection.Register(srv)
+	}
+
+	return srv, nil
+}
+
+// grpcPlaintextWarned records the prefixes of the gRPC servers that have
+// already warned about serving plaintext.
+var grpcPlaintextWarned sync.Map
+
+// tlsPathsFromFlags returns the paths from the "$PREFIX-tls-cert-path" and
+// "$PREFIX-tls-key-path" flags, which must be provided together.
+func tlsPathsFromFlags(cmd *cobra.Command, flagPrefix string) (certPath, keyPath string, err error) {
+	certFlag := flagPrefix + "-tls-cert-path"
+	keyFlag := flagPrefix + "-tls-key-path"
+	if err := MustBeSetTogether(cmd, certFlag, keyFlag); err != nil {
+		return "", "", err
+	}
+
+	certPath = MustGetStringExpanded(cmd, certFlag)
+	keyPath = MustGetStringExpanded(cmd, keyFlag)
+	if (certPath == "") != (keyPath == "") {
+		return "", "", fmt.Errorf("flags --%s and --%s must either both be empty or both be non-empty", certFlag, keyFlag)
+	}
+	return certPath, keyPath, nil
+}
+
+// loadKeyPair loads the TLS certificate and key at the provided paths so that
+// a mismatched or unreadable pair is reported before any handshake occurs.
+func loadKeyPair(flagPrefix, certPath, keyPath string) (tls.Certificate, error) {
+	cert, err := tls.LoadX509KeyPair(certPath, keyPath)
+	if err != nil {
+		return tls.Certificate{}, fmt.Errorf(
+			"invalid --%s-tls-cert-path %q and --%s-tls-key-path %q: %w",
 			flagPrefix,
+			certPath,
 			flagPrefix,
+			keyPath,
+			err,
 		)
 	}
+	return cert, nil
+}
+
+// certPoolFromFile creates an *x509.CertPool from a PEM bundle at the
+// provided path.
+func certPoolFromFile(path string) (*x509.CertPool, error) {
+	pemBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CA bundle: %w", err)
+	}
+
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(pemBytes) {
+		return nil, fmt.Errorf("failed to parse CA bundle: no certificates found in %s", path)
+	}
+	return pool, nil
+}
+
+// verifyAllowedCNs returns a tls.Config VerifyPeerCertificate callback that
+// rejects verified client certificates whose common name and DNS SANs are all
+// absent from the provided list.
+func verifyAllowedCNs(allowed []string) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 || len(verifiedChains[0]) == 0 {
+			return errors.New("client certificate was not verified")
+		}
+
+		leaf := verifiedChains[0][0]
+		if stringz.SliceContains(allowed, leaf.Subject.CommonName) {
+			return nil
+		}
+		for _, name := range leaf.DNSNames {
+			if stringz.SliceContains(allowed, name) {
+				return nil
+			}
+		}
+		return fmt.Errorf("client certificate %q is not allowed", leaf.Subject.CommonName)
+	}
+}
+
+// crlsFromFile parses the certificate revocation lists at the provided path,
+// which may either be a PEM bundle or a single DER-encoded list.
+//
+// The lists are read once, so a server must be restarted to pick up updates.
+func crlsFromFile(path string) ([]*x509.RevocationList, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read CRL: %w", err)
+	}
+
+	var crls []*x509.RevocationList
+	for rest := data; ; {
+		var block *pem.Block
+		if block, rest = pem.Decode(rest); block == nil {
+			break
+		}
+		if block.Type != "X509 CRL" {
+			continue
+		}
+		crl, err := x509.ParseRevocationList(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL in %s: %w", path, err)
+		}
+		crls = append(crls, crl)
+	}
+	if len(crls) == 0 {
+		crl, err := x509.ParseRevocationList(data)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse CRL: no PEM or DER CRL found in %s: %w", path, err)
+		}
+		crls = append(crls, crl)
+	}
+
+	for _, crl := range crls {
+		if !crl.NextUpdate.IsZero() && time.Now().After(crl.NextUpdate) {
+			log.Warn().Str("path", path).Time("next update", crl.NextUpdate).Msg("CRL is past its next update")
+		}
+	}
+	return crls, nil
+}
+
+// verifyNotRevoked returns a tls.Config VerifyPeerCertificate callback that
+// rejects client certificates, or their intermediates, that are revoked by one
+// of the provided CRLs.
+//
+// A CRL only applies to the certificates of the issuer that signed it.
+func verifyNotRevoked(crls []*x509.RevocationList) func([][]byte, [][]*x509.Certificate) error {
+	return func(_ [][]byte, verifiedChains [][]*x509.Certificate) error {
+		if len(verifiedChains) == 0 {
+			return errors.New("client certificate was not verified")
+		}
+
+		// The certificate is allowed if any of its chains is free of revoked
+		// certificates.
+		var err error
+		for _, chain := range verifiedChains {
+			if err = checkNotRevoked(chain, crls); err == nil {
+				return nil
+			}
+		}
+		return err
+	}
+}
+
+func checkNotRevoked(chain []*x509.Certificate, crls []*x509.RevocationList) error {
+	for i := 0; i+1 < len(chain); i++ {
+		cert, issuer := chain[i], chain[i+1]
+		for _, crl := range crls {
+			if !bytes.Equal(crl.RawIssuer, cert.RawIssuer) || crl.CheckSignatureFrom(issuer) != nil {
+				continue
+			}
+			for _, entry := range crl.RevokedCertificateEntries {
+				if entry.SerialNumber.Cmp(cert.SerialNumber) == 0 {
+					return fmt.Errorf("client certificate %q is revoked", cert.Subject.CommonName)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// verifyAll returns a tls.Config VerifyPeerCertificate callback that calls
+// each of the provided callbacks, returning the first error.
+func verifyAll(verifiers ...func([][]byte, [][]*x509.Certificate) error) func([][]byte, [][]*x509.Certificate) error {
+	return func(rawCerts [][]byte, verifiedChains [][]*x509.Certificate) error {
+		for _, verify := range verifiers {
+			if err := verify(rawCerts, verifiedChains); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// RegisterGrpcHealthAndReflection registers the gRPC health and reflection
+// services on the provided server.
+//
+// The returned health server reports SERVING for the empty service name and
+// can be used to update the serving status.
+func RegisterGrpcHealthAndReflection(srv *grpc.Server) *health.Server {
+	reflection.Register(srv)
+	return registerGrpcHealth(srv)
+}
+
+func registerGrpcHealth(srv *grpc.Server) *health.Server {
+	healthSrv := health.NewServer()
+	healthSrv.SetServingStatus("", healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, healthSrv)
+	return healthSrv
 }
 
 // GrpcListenFromFlags listens on an gRPC server using the configuration stored
 // in the cobra command that was registered with RegisterGrpcServerFlags.
 func GrpcListenFromFlags(cmd *cobra.Command, flagPrefix string, srv *grpc.Server) error {
+	return GrpcListenFromFlagsContext(context.Background(), cmd, flagPrefix, srv)
+}
+
+// GrpcListenFromFlagsContext listens on an gRPC server using the
+// configuration stored in the cobra command that was registered with
+// RegisterGrpcServerFlags.
+//
+// Addresses with a "unix://" scheme listen on a Unix domain socket.
+//
+// When the provided context is cancelled, the server is gracefully stopped
+// and nil is returned once it has finished.
+func GrpcListenFromFlagsContext(ctx context.Context, cmd *cobra.Command, flagPrefix string, srv *grpc.Server) error {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "grpc")
 
 	if !MustGetBool(cmd, flagPrefix+"-enabled") {
+		StartupComplete(cmd) // A disabled server has nothing left to start.
 		return nil
 	}
 
-	addr := MustGetStringExpanded(cmd, flagPrefix+"-addr")
-	l, err := net.Listen("tcp", addr)
+	l, err := listen(MustGetStringExpanded(cmd, flagPrefix+"-addr"))
 	if err != nil {
 		return fmt.Errorf("failed to listen on addr for gRPC server: %w", err)
 	}
+	StartupComplete(cmd)
+
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			srv.GracefulStop()
+		case <-done:
+		}
+	}()
 
-	if err := srv.Serve(l); err != nil {
+	err = srv.Serve(l)
+	close(done)
+	<-stopped
+
+	// Serve reports ErrServerStopped if the context was already cancelled and
+	// the server was stopped before it started serving.
+	if err != nil && !errors.Is(err, grpc.ErrServerStopped) {
 		return fmt.Errorf("failed to serve gRPC: %w", err)
 	}
 
 	return nil
 }
 
+// listen creates a net.Listener for the provided address.
+//
+// Addresses with a "unix://" scheme listen on a Unix domain socket that only
+// the current user can access, replacing any stale socket at that path.
+// All other addresses listen on TCP.
+func listen(addr string) (net.Listener, error) {
+	if !strings.HasPrefix(addr, "unix://") {
+		return net.Listen("tcp", addr)
+	}
+
+	path := strings.TrimPrefix(addr, "unix://")
+	if fi, err := os.Lstat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(path); err != nil {
+			return nil, fmt.Errorf("failed to remove stale socket: %w", err)
+		}
+	}
+
+	l, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.Chmod(path, 0o600); err != nil {
+		l.Close()
+		return nil, fmt.Errorf("failed to set socket permissions: %w", err)
+	}
+
+	return l, nil
+}
+
+// WaitForGrpcReady blocks until the gRPC server at the provided address
+// accepts connections or the context expires.
+//
+// If no DialOptions are provided, the connection is attempted in plaintext.
+func WaitForGrpcReady(ctx context.Context, addr string, opts ...grpc.DialOption) error {
+	if len(opts) == 0 {
+		opts = []grpc.DialOption{grpc.WithInsecure()}
+	}
+	opts = append(opts, grpc.WithBlock())
+
+	conn, err := grpc.DialContext(ctx, addr, opts...)
+	if err != nil {
+		return fmt.Errorf("failed waiting for gRPC server at %s to become ready: %w", addr, err)
+	}
+
+	return conn.Close()
+}
+
+// CheckPortAvailable returns an error if the provided TCP address cannot
+// currently be listened on.
+//
+// This is useful in a PreRunE to fail fast before a lengthy initialization.
+func CheckPortAvailable(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return fmt.Errorf("address %s is unavailable: %w", addr, err)
+	}
+	return l.Close()
+}
+
 // RegisterHttpServerFlags adds the following flags for use with
 // HttpServerFromFlags:
 // - "$PREFIX-addr"
 // - "$PREFIX-tls-cert-path"
 // - "$PREFIX-tls-key-path"
+// - "$PREFIX-tls-session-tickets"
 // - "$PREFIX-enabled"
+// - "$PREFIX-grpc-web"
+// - "$PREFIX-trusted-proxies"
+// - "$PREFIX-read-header-timeout"
+// - "$PREFIX-read-timeout"
+// - "$PREFIX-write-timeout"
+// - "$PREFIX-idle-timeout"
+// - "$PREFIX-max-conn-age"
+// - "$PREFIX-keepalives-enabled"
+// - "$PREFIX-shutdown-grace-period"
 func RegisterHttpServerFlags(flags *pflag.FlagSet, flagPrefix, serviceName, defaultAddr string, defaultEnabled bool) {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "http")
 	serviceName = stringz.DefaultEmpty(serviceName, "http")
 	defaultAddr = stringz.DefaultEmpty(defaultAddr, ":8443")
+	registerPrefix(flagPrefix, "http")
 
 	flags.String(flagPrefix+"-addr", defaultAddr, "address to listen on to serve "+serviceName)
 	flags.String(flagPrefix+"-tls-cert-path", "", "local path to the TLS certificate used to serve "+serviceName)
 	flags.String(flagPrefix+"-tls-key-path", "", "local path to the TLS key used to serve "+serviceName)
+	flags.Bool(flagPrefix+"-tls-session-tickets", true, "enable TLS session ticket resumption for connections serving "+serviceName)
 	flags.Bool(flagPrefix+"-enabled", defaultEnabled, "enable "+serviceName+" http server")
+	flags.Bool(flagPrefix+"-grpc-web", false, "enable serving gRPC-Web requests from "+serviceName+" http server")
+	flags.StringSlice(flagPrefix+"-trusted-proxies", nil, "CIDRs of proxies trusted to set X-Forwarded-For for requests to "+serviceName)
+	flags.Duration(flagPrefix+"-read-header-timeout", 10*time.Second, "maximum duration for reading the headers of a request to "+serviceName+" (0 to disable)")
+	flags.Duration(flagPrefix+"-read-timeout", 0, "maximum duration for reading an entire request to "+serviceName+", including the body of each HTTP/2 stream (0 to disable)")
+	flags.Duration(flagPrefix+"-write-timeout", 0, "maximum duration for writing a response from "+serviceName+" (0 to disable)")
+	flags.Duration(flagPrefix+"-idle-timeout", 120*time.Second, "how long an idle keep-alive connection to "+serviceName+" should be able to live")
+	flags.Duration(flagPrefix+"-max-conn-age", 0, "how long a connection serving "+serviceName+" should be able to live before it is gracefully closed (0 disables)")
+	flags.Bool(flagPrefix+"-keepalives-enabled", true, "enable keep-alive connections to "+serviceName)
+	flags.Duration(flagPrefix+"-shutdown-grace-period", 30*time.Second, "how long to wait for in-flight requests to "+serviceName+" to finish when shutting down")
+}
+
+// HttpServerOption is used to configure an *http.Server created by
+// HttpServerFromFlags.
+type HttpServerOption func(*http.Server)
+
+// WithHttpHandler configures the handler used to serve requests.
+//
+// Without this option, http.DefaultServeMux is used.
+func WithHttpHandler(handler http.Handler) HttpServerOption {
+	return func(srv *http.Server) {
+		srv.Handler = handler
+	}
 }
 
 // HttpServerFromFlags creates an *http.Server as configured by the flags from
-// RegisterGrpcServerFlags().
-func HttpServerFromFlags(cmd *cobra.Command, flagPrefix string) *http.Server {
+// RegisterHttpServerFlags().
+//
+// Errors logged by the server are forwarded to zerolog.
+func HttpServerFromFlags(cmd *cobra.Command, flagPrefix string, opts ...HttpServerOption) *http.Server {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "http")
+	srv := &http.Server{
+		Addr:              MustGetStringExpanded(cmd, flagPrefix+"-addr"),
+		Handler:           http.DefaultServeMux,
+		ReadHeaderTimeout: MustGetDuration(cmd, flagPrefix+"-read-header-timeout"),
+		ReadTimeout:       MustGetDuration(cmd, flagPrefix+"-read-timeout"),
+		WriteTimeout:      MustGetDuration(cmd, flagPrefix+"-write-timeout"),
+		IdleTimeout:       MustGetDuration(cmd, flagPrefix+"-idle-timeout"),
+		TLSConfig: &tls.Config{
+			SessionTicketsDisabled: !MustGetBool(cmd, flagPrefix+"-tls-session-tickets"),
+		},
+		ErrorLog: stdlog.New(httpErrorLogWriter{flagPrefix: flagPrefix}, "", 0),
+	}
+
+	srv.SetKeepAlivesEnabled(MustGetBool(cmd, flagPrefix+"-keepalives-enabled"))
+
+	for _, opt := range opts {
+		opt(srv)
+	}
+
+	if maxAge := MustGetDuration(cmd, flagPrefix+"-max-conn-age"); maxAge > 0 {
+		withMaxConnAge(srv, flagPrefix, maxAge)
+	}
+
+	return srv
+}
+
+// httpErrorLogWriter forwards the errors that an http.Server logs, such as
+// failed TLS handshakes, to zerolog.
+type httpErrorLogWriter struct {
+	flagPrefix string
+}
+
+func (w httpErrorLogWriter) Write(p []byte) (int, error) {
+	msg := strings.TrimSpace(string(p))
+	event := log.Warn()
+	if strings.HasPrefix(msg, "http: panic serving") {
+		event = log.Error()
+	}
+	event.Str("prefix", w.flagPrefix).Msg(msg)
+	return len(p), nil
+}
+
+// GrpcWebHandlerFromFlags wraps the provided handler such that gRPC-Web
+// requests are bridged to the provided gRPC server, if enabled by the flags
+// from RegisterHttpServerFlags().
+//
+// All other requests are served by the provided handler, which defaults to
+// http.DefaultServeMux when nil.
+func GrpcWebHandlerFromFlags(cmd *cobra.Command, flagPrefix string, grpcSrv *grpc.Server, handler http.Handler) http.Handler {
 	flagPrefix = stringz.DefaultEmpty(flagPrefix, "http")
-	return &http.Server{
-		Addr: MustGetStringExpanded(cmd, flagPrefix+"-addr"),
+	if handler == nil {
+		handler = http.DefaultServeMux
 	}
+
+	if !MustGetBool(cmd, flagPrefix+"-grpc-web") {
+		return handler
+	}
+
+	wrapped := grpcweb.WrapServer(grpcSrv)
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if wrapped.IsGrpcWebRequest(r) || wrapped.IsAcceptableGrpcCorsRequest(r) {
+			wrapped.ServeHTTP(w, r)
+			return
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
+
+// ForwardedForHandlerFromFlags wraps the provided handler such that the
+// RemoteAddr of requests from the proxies configured by the flags from
+// RegisterHttpServerFlags() is replaced by the client address in their
+// X-Forwarded-For header.
+//
+// The provided handler defaults to http.DefaultServeMux when nil and is
+// returned unwrapped if no proxies are trusted.
+func ForwardedForHandlerFromFlags(cmd *cobra.Command, flagPrefix string, handler http.Handler) (http.Handler, error) {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "http")
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+
+	var trusted []*net.IPNet
+	for _, cidr := range MustGetStringSlice(cmd, flagPrefix+"-trusted-proxies") {
+		_, ipnet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, fmt.Errorf("invalid --%s-trusted-proxies: %w", flagPrefix, err)
+		}
+		trusted = append(trusted, ipnet)
+	}
+
+	if len(trusted) == 0 {
+		return handler, nil
+	}
+
+	isTrusted := func(addr string) bool {
+		ip := net.ParseIP(addr)
+		if ip == nil {
+			return false
+		}
+		for _, ipnet := range trusted {
+			if ipnet.Contains(ip) {
+				return true
+			}
+		}
+		return false
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		peer, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil || !isTrusted(peer) {
+			handler.ServeHTTP(w, r)
+			return
+		}
+
+		// Walk X-Forwarded-For from the nearest hop, stopping at the first
+		// address that isn't a trusted proxy.
+		var hops []string
+		for _, header := range r.Header.Values("X-Forwarded-For") {
+			hops = append(hops, strings.Split(header, ",")...)
+		}
+
+		client := peer
+		for i := len(hops) - 1; i >= 0; i-- {
+			hop := strings.TrimSpace(hops[i])
+			if net.ParseIP(hop) == nil {
+				break
+			}
+			client = hop
+			if !isTrusted(hop) {
+				break
+			}
+		}
+
+		if client != peer {
+			r = r.Clone(r.Context())
+			r.RemoteAddr = net.JoinHostPort(client, "0")
+		}
+		handler.ServeHTTP(w, r)
+	}), nil
 }
 
 // HttpListenFromFlags listens on an HTTP server using the configuration stored
 // in the cobra command that was registered with RegisterHttpServerFlags.
 func HttpListenFromFlags(cmd *cobra.Command, flagPrefix string, srv *http.Server) error {
+	return HttpListenFromFlagsContext(context.Background(), cmd, flagPrefix, srv)
+}
+
+// HttpListenFromFlagsContext listens on an HTTP server using the configuration
+// stored in the cobra command that was registered with
+// RegisterHttpServerFlags.
+//
+// Addresses with a "unix://" scheme listen on a Unix domain socket.
+//
+// When the provided context is cancelled, the server is shutdown and nil is
+// returned once in-flight requests have finished. If they do not finish
+// within "$PREFIX-shutdown-grace-period", the server is closed forcefully.
+func HttpListenFromFlagsContext(ctx context.Context, cmd *cobra.Command, flagPrefix string, srv *http.Server) error {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "http")
+
 	if !MustGetBool(cmd, flagPrefix+"-enabled") {
+		StartupComplete(cmd) // A disabled server has nothing left to start.
 		return nil
 	}
 
-	certPath := MustGetStringExpanded(cmd, flagPrefix+"-tls-cert-path")
-	keyPath := MustGetStringExpanded(cmd, flagPrefix+"-tls-key-path")
+	certPath, keyPath, err := tlsPathsFromFlags(cmd, flagPrefix)
+	if err != nil {
+		return fmt.Errorf("failed to start http server: %w", err)
+	}
 
+	addr := srv.Addr
+	var serve func(l net.Listener) error
 	switch {
 	case certPath == "" && keyPath == "":
+		addr = stringz.DefaultEmpty(addr, ":http")
 		log.Warn().Str("prefix", flagPrefix).Msg("http server serving plaintext")
-		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			return fmt.Errorf("failed while serving http: %w", err)
-		}
-		return nil
-	case certPath != "" && keyPath != "":
-		if err := srv.ListenAndServeTLS(certPath, keyPath); err != nil && err != http.ErrServerClosed {
-			return fmt.Errorf("failed while serving https: %w", err)
+		serve = func(l net.Listener) error {
+			if err := srv.Serve(l); err != nil && err != http.ErrServerClosed {
+				return fmt.Errorf("failed while serving http: %w", err)
+			}
+			return nil
 		}
-		return nil
 	default:
-		return fmt.Errorf("failed to start http server: must provide both --%s-tls-cert-path and --%s-tls-key-path",
-			flagPrefix,
-			flagPrefix,
-		)
+		addr = stringz.DefaultEmpty(addr, ":https")
+		if _, err := loadKeyPair(flagPrefix, certPath, keyPath); err != nil {
+			return fmt.Errorf("failed to start http server: %w", err)
+		}
+		serve = func(l net.Listener) error {
+			if err := srv.ServeTLS(l, certPath, keyPath); err != nil && err != http.ErrServerClosed {
+				return fmt.Errorf("failed while serving https: %w", err)
+			}
+			return nil
+		}
+	}
+
+	l, err := listen(addr)
+	if err != nil {
+		return fmt.Errorf("failed to listen on addr for http server: %w", err)
 	}
+	StartupComplete(cmd)
+
+	return serveHttpUntilDone(ctx, srv, flagPrefix, MustGetDuration(cmd, flagPrefix+"-shutdown-grace-period"), func() error {
+		return serve(l)
+	})
+}
+
+// CombinedListenFromFlags serves both the provided gRPC server and HTTP
+// handler on the listener configured by the flags from
+// RegisterHttpServerFlags().
+func CombinedListenFromFlags(cmd *cobra.Command, httpPrefix string, grpcSrv *grpc.Server, gatewayHandler http.Handler) error {
+	return CombinedListenFromFlagsContext(context.Background(), cmd, httpPrefix, grpcSrv, gatewayHandler)
+}
+
+// CombinedListenFromFlagsContext serves both the provided gRPC server and HTTP
+// handler on the listener configured by the flags from
+// RegisterHttpServerFlags().
+//
+// Requests are routed to the gRPC server if they are HTTP/2 with a
+// "application/grpc" content type and to the handler otherwise. Without TLS,
+// HTTP/2 is served in cleartext (h2c).
+//
+// The server is shutdown as described by HttpListenFromFlagsContext().
+func CombinedListenFromFlagsContext(ctx context.Context, cmd *cobra.Command, httpPrefix string, grpcSrv *grpc.Server, gatewayHandler http.Handler) error {
+	srv := combinedServerFromFlags(cmd, httpPrefix, grpcSrv, gatewayHandler)
+	return HttpListenFromFlagsContext(ctx, cmd, httpPrefix, srv)
+}
+
+// combinedServerFromFlags creates the *http.Server used by
+// CombinedListenFromFlagsContext().
+func combinedServerFromFlags(cmd *cobra.Command, httpPrefix string, grpcSrv *grpc.Server, gatewayHandler http.Handler) *http.Server {
+	httpPrefix = stringz.DefaultEmpty(httpPrefix, "http")
+	if gatewayHandler == nil {
+		gatewayHandler = http.DefaultServeMux
+	}
+
+	combined := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.ProtoMajor == 2 && strings.HasPrefix(r.Header.Get("Content-Type"), "application/grpc") {
+			grpcSrv.ServeHTTP(w, r)
+			return
+		}
+		gatewayHandler.ServeHTTP(w, r)
+	})
+
+	// The h2c handler serves HTTP/2 streams with the handler it wraps, so it
+	// must wrap the handler configured by HttpServerFromFlags(), rather than
+	// be wrapped by it, for the "$PREFIX-max-conn-age" to apply to them.
+	srv := HttpServerFromFlags(cmd, httpPrefix, WithHttpHandler(combined))
+	srv.Handler = h2c.NewHandler(srv.Handler, &http2.Server{
+		IdleTimeout: MustGetDuration(cmd, httpPrefix+"-idle-timeout"),
+	})
+	return srv
+}
+
+// serveHttpUntilDone calls serve and shuts down the provided server when the
+// context is cancelled, closing it forcefully if in-flight requests do not
+// finish within the grace period.
+func serveHttpUntilDone(ctx context.Context, srv *http.Server, flagPrefix string, gracePeriod time.Duration, serve func() error) error {
+	done := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		select {
+		case <-ctx.Done():
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), gracePeriod)
+			defer cancel()
+			if err := srv.Shutdown(shutdownCtx); err != nil {
+				log.Warn().Err(err).Str("prefix", flagPrefix).Msg("http server failed to shutdown gracefully")
+				_ = srv.Close()
+			}
+		case <-done:
+		}
+	}()
+
+	err := serve()
+	close(done)
+	<-stopped
+	return err
 }
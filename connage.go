@@ -0,0 +1,53 @@
+package cobrautil
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// minHttpMaxConnAge is the smallest "$PREFIX-max-conn-age" that is honored;
+// anything shorter would recycle connections on nearly every request.
+const minHttpMaxConnAge = time.Second
+
+type connAcceptedKey struct{}
+
+// withMaxConnAge configures the provided server to gracefully close
+// connections that are older than maxAge by responding to their requests with
+// a "Connection: close" header.
+//
+// HTTP/1 connections are closed once that response is written and HTTP/2
+// connections are sent a GOAWAY, so in-flight requests finish and clients
+// reconnect elsewhere.
+func withMaxConnAge(srv *http.Server, flagPrefix string, maxAge time.Duration) {
+	if maxAge < minHttpMaxConnAge {
+		log.Warn().
+			Str("prefix", flagPrefix).
+			Dur("max-conn-age", maxAge).
+			Dur("minimum", minHttpMaxConnAge).
+			Msg("http max connection age is too short; using the minimum")
+		maxAge = minHttpMaxConnAge
+	}
+
+	connContext := srv.ConnContext
+	srv.ConnContext = func(ctx context.Context, c net.Conn) context.Context {
+		if connContext != nil {
+			ctx = connContext(ctx, c)
+		}
+		return context.WithValue(ctx, connAcceptedKey{}, time.Now())
+	}
+
+	handler := srv.Handler
+	if handler == nil {
+		handler = http.DefaultServeMux
+	}
+	srv.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if accepted, ok := r.Context().Value(connAcceptedKey{}).(time.Time); ok && time.Since(accepted) >= maxAge {
+			w.Header().Set("Connection", "close")
+		}
+		handler.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,137 @@
+package cobrautil
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"golang.org/x/net/http2"
+	"google.golang.org/grpc"
+)
+
+func TestWithMaxConnAge(t *testing.T) {
+	for _, http2 := range []bool{false, true} {
+		name := "http1"
+		if http2 {
+			name = "http2"
+		}
+		t.Run(name, func(t *testing.T) {
+			srv := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				_, _ = w.Write([]byte("ok"))
+			})}
+			withMaxConnAge(srv, "http", time.Nanosecond) // Clamped to the minimum.
+
+			ts := httptest.NewUnstartedServer(srv.Handler)
+			ts.Config.ConnContext = srv.ConnContext
+			ts.EnableHTTP2 = http2
+			ts.StartTLS()
+			defer ts.Close()
+			client := ts.Client()
+
+			get := func() (reused, closing bool) {
+				var info httptrace.GotConnInfo
+				ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+					GotConn: func(i httptrace.GotConnInfo) { info = i },
+				})
+				req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+				if err != nil {
+					t.Fatal(err)
+				}
+				resp, err := client.Do(req)
+				if err != nil {
+					t.Fatal(err)
+				}
+				_, _ = io.ReadAll(resp.Body)
+				resp.Body.Close()
+				if http2 && resp.ProtoMajor != 2 {
+					t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+				}
+				return info.Reused, resp.Close || resp.Header.Get("Connection") == "close"
+			}
+
+			if _, closing := get(); closing {
+				t.Fatal("new connection was closed")
+			}
+			if reused, _ := get(); !reused {
+				t.Fatal("young connection was not reused")
+			}
+
+			time.Sleep(minHttpMaxConnAge + 100*time.Millisecond)
+			if reused, closing := get(); !reused || (!http2 && !closing) {
+				t.Fatalf("expected aged connection to serve one last request and close, got reused=%v closing=%v", reused, closing)
+			}
+
+			time.Sleep(100 * time.Millisecond) // Let the client observe the close.
+			if reused, _ := get(); reused {
+				t.Fatal("aged connection was reused")
+			}
+		})
+	}
+}
+
+func TestCombinedServerMaxConnAgeOverH2C(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	RegisterHttpServerFlags(cmd.Flags(), "http", "http", "", true)
+	if err := cmd.Flags().Set("http-max-conn-age", minHttpMaxConnAge.String()); err != nil {
+		t.Fatal(err)
+	}
+	gateway := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("ok"))
+	})
+	srv := combinedServerFromFlags(cmd, "http", grpc.NewServer(), gateway)
+
+	ts := httptest.NewUnstartedServer(srv.Handler)
+	ts.Config = srv
+	ts.Start()
+	defer ts.Close()
+
+	// Speak HTTP/2 with prior knowledge, as gRPC clients do without TLS.
+	client := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLS: func(network, addr string, _ *tls.Config) (net.Conn, error) {
+			return net.Dial(network, addr)
+		},
+	}}
+	get := func() (reused bool) {
+		var info httptrace.GotConnInfo
+		ctx := httptrace.WithClientTrace(context.Background(), &httptrace.ClientTrace{
+			GotConn: func(i httptrace.GotConnInfo) { info = i },
+		})
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _ = io.ReadAll(resp.Body)
+		resp.Body.Close()
+		if resp.ProtoMajor != 2 {
+			t.Fatalf("expected HTTP/2, got %s", resp.Proto)
+		}
+		return info.Reused
+	}
+
+	get()
+	if !get() {
+		t.Fatal("young connection was not reused")
+	}
+
+	time.Sleep(minHttpMaxConnAge + 100*time.Millisecond)
+	if !get() {
+		t.Fatal("expected aged connection to serve one last request")
+	}
+
+	time.Sleep(100 * time.Millisecond) // Let the client observe the GOAWAY.
+	if get() {
+		t.Fatal("aged connection was reused")
+	}
+}
@@ -0,0 +1,134 @@
+package cobrautil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// EnumFlag is a pflag.Value for string flags that only accept a fixed set of
+// values.
+//
+// Values are matched case-insensitively and stored as they were provided to
+// NewEnumFlag.
+type EnumFlag struct {
+	value   string
+	allowed []string
+}
+
+var _ pflag.Value = (*EnumFlag)(nil)
+
+// NewEnumFlag creates an EnumFlag that defaults to the provided value and
+// accepts only the allowed values.
+func NewEnumFlag(defaultValue string, allowed ...string) *EnumFlag {
+	return &EnumFlag{value: defaultValue, allowed: allowed}
+}
+
+// String returns the current value of the flag.
+func (e *EnumFlag) String() string { return e.value }
+
+// Set validates and stores the provided value.
+func (e *EnumFlag) Set(value string) error {
+	for _, allowed := range e.allowed {
+		if strings.EqualFold(value, allowed) {
+			e.value = allowed
+			return nil
+		}
+	}
+	if suggestion := closestValue(value, e.allowed); suggestion != "" {
+		return fmt.Errorf("must be one of %s; did you mean %q?", quoteValues(e.allowed), suggestion)
+	}
+	return fmt.Errorf("must be one of %s", quoteValues(e.allowed))
+}
+
+// Type returns "string" so that an EnumFlag can also be read like any other
+// string flag.
+func (e *EnumFlag) Type() string { return "string" }
+
+// Allowed returns the values accepted by the flag.
+func (e *EnumFlag) Allowed() []string { return e.allowed }
+
+// Complete is a cobra flag completion func that suggests the allowed values.
+func (e *EnumFlag) Complete(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return e.allowed, cobra.ShellCompDirectiveNoFileComp
+}
+
+// RegisterEnumFlag adds a flag that only accepts the allowed values to the
+// provided FlagSet.
+//
+// The allowed values are appended to the usage string.
+func RegisterEnumFlag(flags *pflag.FlagSet, name, defaultValue, usage string, allowed ...string) *EnumFlag {
+	e := NewEnumFlag(defaultValue, allowed...)
+	flags.Var(e, name, usage+" ("+quoteValues(allowed)+")")
+	return e
+}
+
+// RegisterEnumCompletions registers shell completions for every EnumFlag
+// defined on the provided command.
+func RegisterEnumCompletions(cmd *cobra.Command) error {
+	var err error
+	registered := make(map[string]struct{})
+	visit := func(f *pflag.Flag) {
+		if _, ok := registered[f.Name]; ok || err != nil {
+			return
+		}
+		if e, ok := f.Value.(*EnumFlag); ok {
+			registered[f.Name] = struct{}{}
+			err = cmd.RegisterFlagCompletionFunc(f.Name, e.Complete)
+		}
+	}
+	cmd.Flags().VisitAll(visit)
+	cmd.PersistentFlags().VisitAll(visit)
+	return err
+}
+
+// closestValue returns the allowed value with the smallest edit distance
+// from the provided value, or an empty string if none are close enough to be
+// a plausible typo.
+func closestValue(value string, allowed []string) string {
+	value = strings.ToLower(value)
+
+	var closest string
+	closestDistance := -1
+	for _, candidate := range allowed {
+		d := levenshtein(value, strings.ToLower(candidate))
+		if d <= 2 && d < len(candidate) && (closestDistance < 0 || d < closestDistance) {
+			closest, closestDistance = candidate, d
+		}
+	}
+	return closest
+}
+
+// levenshtein returns the number of single-rune insertions, deletions, or
+// substitutions required to turn a into b.
+func levenshtein(a, b string) int {
+	ar, br := []rune(a), []rune(b)
+	prev := make([]int, len(br)+1)
+	curr := make([]int, len(br)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ar); i++ {
+		curr[0] = i
+		for j := 1; j <= len(br); j++ {
+			cost := 1
+			if ar[i-1] == br[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(br)]
+}
+
+func quoteValues(values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, `"`+value+`"`)
+	}
+	return strings.Join(quoted, ", ")
+}
@@ -1,6 +1,8 @@
 package cobrautil_test
 
 import (
+	"fmt"
+
 	"github.com/rs/zerolog"
 	"github.com/spf13/cobra"
 
@@ -36,3 +38,42 @@ func ExampleZeroLogPreRunE() {
 
 	cobrautil.RegisterZeroLogFlags(cmd.PersistentFlags(), "log")
 }
+
+func ExampleRegisterEnumFlag() {
+	cmd := &cobra.Command{
+		Use: "mycmd",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Println(cobrautil.MustGetEnum(cmd, "color"))
+			return nil
+		},
+	}
+
+	cobrautil.RegisterEnumFlag(cmd.Flags(), "color", "red", "color of the thing", "red", "green", "blue")
+	_ = cobrautil.RegisterEnumCompletions(cmd)
+
+	cmd.SetArgs([]string{"--color", "green"})
+	_ = cmd.Execute()
+	// Output: green
+}
+
+func ExampleEnumFlag_Set() {
+	cmd := &cobra.Command{
+		Use: "mycmd",
+		RunE: func(cmd *cobra.Command, args []string) error {
+			fmt.Println(cobrautil.MustGetEnum(cmd, "otel-provider"))
+			fmt.Println(cobrautil.MustGetEnum(cmd, "log-format"))
+			fmt.Println(cobrautil.MustGetEnum(cmd, "log-level"))
+			return nil
+		},
+	}
+
+	cobrautil.RegisterOpenTelemetryFlags(cmd.Flags(), "otel", "mycmd")
+	cobrautil.RegisterZeroLogFlags(cmd.Flags(), "log")
+
+	cmd.SetArgs([]string{"--otel-provider", "JAEGER", "--log-format", "Json", "--log-level", "dEbUg"})
+	_ = cmd.Execute()
+	// Output:
+	// jaeger
+	// json
+	// debug
+}
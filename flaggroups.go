@@ -0,0 +1,73 @@
+package cobrautil
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+)
+
+// MustBeSetTogether returns an error if some, but not all, of the named flags
+// were set on the provided command.
+//
+// A flag is considered set if it was provided explicitly, even if it was set
+// to an empty value.
+func MustBeSetTogether(cmd *cobra.Command, names ...string) error {
+	set, unset, err := partitionChanged(cmd, names)
+	if err != nil {
+		return err
+	}
+
+	if len(set) > 0 && len(unset) > 0 {
+		return fmt.Errorf("flags %s must be set together: %s set but %s not set",
+			joinFlagNames(names),
+			joinFlagNames(set),
+			joinFlagNames(unset),
+		)
+	}
+	return nil
+}
+
+// MutuallyExclusive returns an error if more than one of the named flags was
+// set on the provided command.
+//
+// A flag is considered set if it was provided explicitly, even if it was set
+// to an empty value.
+func MutuallyExclusive(cmd *cobra.Command, names ...string) error {
+	set, _, err := partitionChanged(cmd, names)
+	if err != nil {
+		return err
+	}
+
+	if len(set) > 1 {
+		return fmt.Errorf("flags %s are mutually exclusive: %s set",
+			joinFlagNames(names),
+			joinFlagNames(set),
+		)
+	}
+	return nil
+}
+
+func partitionChanged(cmd *cobra.Command, names []string) (set, unset []string, err error) {
+	for _, name := range names {
+		f := cmd.Flags().Lookup(name)
+		if f == nil {
+			return nil, nil, fmt.Errorf("unknown flag: --%s", name)
+		}
+
+		if f.Changed {
+			set = append(set, name)
+		} else {
+			unset = append(unset, name)
+		}
+	}
+	return set, unset, nil
+}
+
+func joinFlagNames(names []string) string {
+	dashed := make([]string, 0, len(names))
+	for _, name := range names {
+		dashed = append(dashed, "--"+name)
+	}
+	return strings.Join(dashed, ", ")
+}
@@ -0,0 +1,41 @@
+package cobrautil_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+func TestGrpcListenFromFlagsContextAlreadyCancelled(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterGrpcServerFlags(cmd.Flags(), "grpc", "grpc", "127.0.0.1:0", true)
+	if err := cmd.Flags().Set("grpc-tls-insecure", "true"); err != nil {
+		t.Fatal(err)
+	}
+
+	srv, err := cobrautil.GrpcServerFromFlags(cmd, "grpc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := cobrautil.GrpcListenFromFlagsContext(ctx, cmd, "grpc", srv); err != nil {
+		t.Fatalf("expected a clean shutdown, got: %v", err)
+	}
+}
+
+func TestGrpcServerFromFlagsCrlRequiresClientCA(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterGrpcServerFlags(cmd.Flags(), "grpc", "grpc", "127.0.0.1:0", true)
+	if err := cmd.Flags().Set("grpc-tls-crl-path", "crl.pem"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cobrautil.GrpcServerFromFlags(cmd, "grpc"); err == nil {
+		t.Fatal("expected an error for a CRL without a client CA")
+	}
+}
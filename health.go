@@ -0,0 +1,46 @@
+package cobrautil
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/rs/zerolog/log"
+)
+
+// HealthCheck is a function that returns an error when the dependency it
+// checks is unhealthy.
+type HealthCheck func() error
+
+type healthStatus struct {
+	Status string                  `json:"status"`
+	Error  string                  `json:"error,omitempty"`
+	Checks map[string]healthStatus `json:"checks,omitempty"`
+}
+
+// HealthHandler returns an http.Handler that runs each of the provided named
+// checks and responds with a JSON summary of their results.
+//
+// The response has a status code of 200 if every check passed and 503
+// otherwise.
+func HealthHandler(checks map[string]HealthCheck) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		summary := healthStatus{Status: "ok", Checks: make(map[string]healthStatus, len(checks))}
+		code := http.StatusOK
+
+		for name, check := range checks {
+			if err := check(); err != nil {
+				summary.Checks[name] = healthStatus{Status: "error", Error: err.Error()}
+				summary.Status = "error"
+				code = http.StatusServiceUnavailable
+				continue
+			}
+			summary.Checks[name] = healthStatus{Status: "ok"}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(summary); err != nil {
+			log.Warn().Err(err).Msg("failed to write health summary")
+		}
+	})
+}
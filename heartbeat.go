@@ -0,0 +1,43 @@
+package cobrautil
+
+import (
+	"context"
+	"runtime"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// LogHeartbeat logs a message at the provided level every interval, until the
+// provided context is cancelled.
+//
+// Each message includes the time since LogHeartbeat was called and the number
+// of running goroutines so that a silent hang can be told apart from a quiet
+// service.
+//
+// No heartbeat is started if the interval is not positive.
+func LogHeartbeat(ctx context.Context, interval time.Duration, level zerolog.Level) {
+	if interval <= 0 {
+		log.Error().Dur("interval", interval).Msg("heartbeat interval must be positive; not logging heartbeats")
+		return
+	}
+
+	start := time.Now()
+	ticker := time.NewTicker(interval)
+
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+				log.WithLevel(level).
+					Dur("uptime", time.Since(start)).
+					Int("goroutines", runtime.NumGoroutine()).
+					Msg("heartbeat")
+			}
+		}
+	}()
+}
@@ -0,0 +1,20 @@
+package cobrautil_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+func TestLogHeartbeatNonPositiveInterval(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	for _, interval := range []time.Duration{0, -time.Second} {
+		cobrautil.LogHeartbeat(ctx, interval, zerolog.InfoLevel) // Must not panic.
+	}
+}
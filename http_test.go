@@ -0,0 +1,110 @@
+package cobrautil_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+func TestForwardedForHandlerFromFlags(t *testing.T) {
+	tests := []struct {
+		name       string
+		remoteAddr string
+		xff        []string
+		want       string
+	}{
+		{"no header", "10.0.0.1:1234", nil, "10.0.0.1:1234"},
+		{"untrusted peer", "203.0.113.5:1234", []string{"198.51.100.7"}, "203.0.113.5:1234"},
+		{"trusted peer", "10.0.0.1:1234", []string{"198.51.100.7"}, "198.51.100.7:0"},
+		{"trusted chain", "10.0.0.1:1234", []string{"198.51.100.7, 10.0.0.2"}, "198.51.100.7:0"},
+		{"spoofed hop before untrusted client", "10.0.0.1:1234", []string{"192.0.2.1, 198.51.100.7, 10.0.0.2"}, "198.51.100.7:0"},
+		{"trusted hop before untrusted client", "10.0.0.1:1234", []string{"10.0.0.3, 198.51.100.7, 10.0.0.2"}, "198.51.100.7:0"},
+		{"multiple headers", "10.0.0.1:1234", []string{"198.51.100.7", "10.0.0.2"}, "198.51.100.7:0"},
+		{"ipv6 peer and client", "[fd00::1]:1234", []string{"2001:db8::7"}, "[2001:db8::7]:0"},
+		{"nearest hop invalid", "10.0.0.1:1234", []string{"198.51.100.7, not-an-ip"}, "10.0.0.1:1234"},
+		{"invalid hop beyond trusted proxies", "10.0.0.1:1234", []string{"not-an-ip, 10.0.0.2"}, "10.0.0.2:0"},
+		{"empty header", "10.0.0.1:1234", []string{""}, "10.0.0.1:1234"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{Use: "mycmd"}
+			cobrautil.RegisterHttpServerFlags(cmd.Flags(), "http", "http", "", true)
+			if err := cmd.Flags().Set("http-trusted-proxies", "10.0.0.0/8,fd00::/8"); err != nil {
+				t.Fatal(err)
+			}
+
+			var got string
+			handler, err := cobrautil.ForwardedForHandlerFromFlags(cmd, "http", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = r.RemoteAddr
+			}))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r := httptest.NewRequest(http.MethodGet, "/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			for _, xff := range tt.xff {
+				r.Header.Add("X-Forwarded-For", xff)
+			}
+			handler.ServeHTTP(httptest.NewRecorder(), r)
+
+			if got != tt.want {
+				t.Fatalf("got RemoteAddr %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestForwardedForHandlerFromFlagsWithoutTrustedProxies(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterHttpServerFlags(cmd.Flags(), "http", "http", "", true)
+
+	var got string
+	handler, err := cobrautil.ForwardedForHandlerFromFlags(cmd, "http", http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r.RemoteAddr
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.RemoteAddr = "10.0.0.1:1234"
+	r.Header.Set("X-Forwarded-For", "198.51.100.7")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got != "10.0.0.1:1234" {
+		t.Fatalf("got RemoteAddr %q, want it unchanged", got)
+	}
+}
+
+func TestForwardedForHandlerFromFlagsInvalidCIDR(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterHttpServerFlags(cmd.Flags(), "http", "http", "", true)
+	if err := cmd.Flags().Set("http-trusted-proxies", "10.0.0.1"); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := cobrautil.ForwardedForHandlerFromFlags(cmd, "http", nil); err == nil {
+		t.Fatal("expected an error for a bare IP")
+	}
+}
+
+func TestHttpServerFromFlagsTimeoutDefaults(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterHttpServerFlags(cmd.Flags(), "http", "http", "", true)
+	srv := cobrautil.HttpServerFromFlags(cmd, "http")
+
+	// A ReadTimeout would also limit the body of every HTTP/2 stream, cutting
+	// off long-lived streaming calls, so only the headers are limited.
+	if srv.ReadHeaderTimeout <= 0 {
+		t.Fatalf("expected a default ReadHeaderTimeout, got %s", srv.ReadHeaderTimeout)
+	}
+	if srv.ReadTimeout != 0 {
+		t.Fatalf("expected no default ReadTimeout, got %s", srv.ReadTimeout)
+	}
+}
@@ -0,0 +1,144 @@
+// Package logflags implements the parts of configuring logging from cobra
+// flags that are shared by cobrautil and slogutil.
+//
+// It must not depend on a logging library, so that importing slogutil does not
+// link zerolog.
+package logflags
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/jzelinskie/stringz"
+	"github.com/mattn/go-isatty"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Levels are the accepted values of the "$PREFIX-level" flag, from the most
+// to the least verbose.
+var Levels = []string{"trace", "debug", "info", "warn", "error", "fatal", "panic"}
+
+// Formats are the accepted values of the "$PREFIX-format" flag.
+var Formats = []string{"auto", "human", "json", "gcp"}
+
+// IsBuiltinCommand checks against a hard-coded list of the names of commands
+// that cobra provides out-of-the-box, including the hidden commands used for
+// shell completion and the subcommands of "completion".
+func IsBuiltinCommand(cmd *cobra.Command) bool {
+	builtins := []string{
+		"help",
+		"completion",
+		cobra.ShellCompRequestCmd,
+		cobra.ShellCompNoDescRequestCmd,
+	}
+
+	if stringz.SliceContains(builtins, cmd.Name()) {
+		return true
+	}
+	return cmd.HasParent() && cmd.Parent().Name() == "completion"
+}
+
+// RegisterOutputFlags adds the following flags:
+// - "$PREFIX-output"
+// - "$PREFIX-max-size"
+// - "$PREFIX-max-backups"
+// - "$PREFIX-max-age"
+func RegisterOutputFlags(flags *pflag.FlagSet, flagPrefix string) {
+	flags.String(flagPrefix+"-output", "auto", `destination of logs ("auto", "stdout", "stderr", or a file path); "auto" writes human-readable logs to stdout and all others to stderr`)
+	flags.Int(flagPrefix+"-max-size", 0, "size in megabytes at which a log file is rotated (0 disables rotation)")
+	flags.Int(flagPrefix+"-max-backups", 0, "number of rotated log files to keep (0 keeps all)")
+	flags.Duration(flagPrefix+"-max-age", 0, "how long to keep rotated log files, rounded up to whole days (0 keeps them forever)")
+}
+
+// OutputFromFlags opens the destination of logs named by the flags from
+// RegisterOutputFlags() and reports whether logs in the provided format should
+// be human-readable.
+//
+// Closing the returned writer closes files, but not stdout or stderr.
+func OutputFromFlags(flags *pflag.FlagSet, flagPrefix, format string) (io.WriteCloser, bool, error) {
+	var output *os.File
+	switch path := os.ExpandEnv(mustGet(flags.GetString, flagPrefix+"-output")); path {
+	case "auto":
+		// Human-readable logs go to stdout and all others to stderr, so that
+		// JSON logs are not mixed into the output of a piped command.
+		if format == "human" || (format == "auto" && isatty.IsTerminal(os.Stdout.Fd())) {
+			return nopCloser{os.Stdout}, true, nil
+		}
+		return nopCloser{os.Stderr}, false, nil
+	case "stdout":
+		output = os.Stdout
+	case "stderr":
+		output = os.Stderr
+	default:
+		f, err := os.OpenFile(path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0o644)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to open log output: %w", err)
+		}
+
+		maxSize := mustGet(flags.GetInt, flagPrefix+"-max-size")
+		if maxSize <= 0 {
+			return f, isHuman(format, f), nil
+		}
+
+		// The file was only opened to report errors before any logs are
+		// written; lumberjack opens it again on the first write.
+		if err := f.Close(); err != nil {
+			return nil, false, fmt.Errorf("failed to open log output: %w", err)
+		}
+
+		maxAge := mustGet(flags.GetDuration, flagPrefix+"-max-age")
+		return &lumberjack.Logger{
+			Filename:   path,
+			MaxSize:    maxSize,
+			MaxBackups: mustGet(flags.GetInt, flagPrefix+"-max-backups"),
+			MaxAge:     int((maxAge + 24*time.Hour - 1) / (24 * time.Hour)),
+		}, format == "human", nil
+	}
+	return nopCloser{output}, isHuman(format, output), nil
+}
+
+// mustGet returns the value of a flag with the given name and panics if that
+// flag was never defined.
+func mustGet[T any](get func(string) (T, error), name string) T {
+	value, err := get(name)
+	if err != nil {
+		panic("failed to find cobra flag: " + name)
+	}
+	return value
+}
+
+func isHuman(format string, f *os.File) bool {
+	return format == "human" || (format == "auto" && isatty.IsTerminal(f.Fd()))
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+// GcpSeverity maps the provided level, one of Levels, to the severity values
+// understood by Google Cloud Logging.
+//
+// For low-level details see:
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogSeverity
+func GcpSeverity(level string) string {
+	switch level {
+	case "trace", "debug":
+		return "DEBUG"
+	case "info":
+		return "INFO"
+	case "warn":
+		return "WARNING"
+	case "error":
+		return "ERROR"
+	case "fatal":
+		return "CRITICAL"
+	case "panic":
+		return "ALERT"
+	default:
+		return "DEFAULT"
+	}
+}
@@ -0,0 +1,164 @@
+package cobrautil
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/jzelinskie/stringz"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// metricsShutdownGracePeriod is how long to wait for in-flight scrapes to
+// finish when shutting down a metrics server.
+const metricsShutdownGracePeriod = 5 * time.Second
+
+// RegisterMetricsServerFlags adds the following flags for use with
+// MetricsServerFromFlags:
+// - "$PREFIX-addr"
+// - "$PREFIX-enabled"
+// - "$PREFIX-pushgateway-url"
+// - "$PREFIX-exemplars"
+func RegisterMetricsServerFlags(flags *pflag.FlagSet, flagPrefix, defaultAddr string, defaultEnabled bool) {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "metrics")
+	defaultAddr = stringz.DefaultEmpty(defaultAddr, ":9090")
+	registerPrefix(flagPrefix, "metrics")
+
+	flags.String(flagPrefix+"-addr", defaultAddr, "address to listen on to serve metrics")
+	flags.Bool(flagPrefix+"-enabled", defaultEnabled, "enable metrics http server")
+	flags.String(flagPrefix+"-pushgateway-url", "", "URL of a Prometheus Pushgateway to push command metrics to")
+	flags.Bool(flagPrefix+"-exemplars", false, "serve metrics in the OpenMetrics format, including exemplars that link observations to traces")
+}
+
+var (
+	commandInvocations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "cobrautil",
+		Name:      "command_invocations_total",
+		Help:      "Number of times a command was run, by command and result.",
+	}, []string{"command", "result"})
+
+	commandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "cobrautil",
+		Name:      "command_duration_seconds",
+		Help:      "Time taken to run a command, by command.",
+		Buckets:   prometheus.ExponentialBuckets(0.01, 4, 10),
+	}, []string{"command"})
+
+	registerCommandMetrics sync.Once
+)
+
+// ObserveWithExemplar records the provided value and, if the context has a
+// sampled span, attaches the ID of its trace as an exemplar.
+func ObserveWithExemplar(ctx context.Context, obs prometheus.Observer, value float64) {
+	if ctx != nil {
+		sc := trace.SpanContextFromContext(ctx)
+		if eo, ok := obs.(prometheus.ExemplarObserver); ok && sc.IsSampled() {
+			eo.ObserveWithExemplar(value, prometheus.Labels{"trace_id": sc.TraceID().String()})
+			return
+		}
+	}
+	obs.Observe(value)
+}
+
+// CommandMetricsRunE wraps the provided run func such that the number of
+// invocations and their durations are recorded in the default Prometheus
+// registry, labeled by the path of the command.
+//
+// If "$PREFIX-pushgateway-url" is set, the metrics are also pushed to that
+// Pushgateway once the run func returns, which is useful for short-lived
+// CLIs that are never scraped. Failing to push is logged but does not fail
+// the command.
+func CommandMetricsRunE(flagPrefix string, fn CobraRunFunc) CobraRunFunc {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "metrics")
+	registerCommandMetrics.Do(func() {
+		prometheus.MustRegister(commandInvocations, commandDuration)
+	})
+
+	return func(cmd *cobra.Command, args []string) error {
+		start := time.Now()
+		err := fn(cmd, args)
+
+		result := "success"
+		if err != nil {
+			result = "error"
+		}
+		commandInvocations.WithLabelValues(cmd.CommandPath(), result).Inc()
+		ObserveWithExemplar(cmd.Context(), commandDuration.WithLabelValues(cmd.CommandPath()), time.Since(start).Seconds())
+
+		if url := MustGetStringExpanded(cmd, flagPrefix+"-pushgateway-url"); url != "" {
+			pushErr := push.New(url, cmd.Root().Name()).
+				Collector(commandInvocations).
+				Collector(commandDuration).
+				Push()
+			if pushErr != nil {
+				log.Warn().Err(pushErr).Str("prefix", flagPrefix).Msg("failed to push command metrics")
+			}
+		}
+
+		return err
+	}
+}
+
+// MetricsServerFromFlags creates an *http.Server that serves Prometheus
+// metrics at "/metrics" as configured by the flags from
+// RegisterMetricsServerFlags().
+//
+// Metrics are gathered from the default Prometheus registry, which includes
+// the Go runtime and process collectors. Exemplars, such as those recorded by
+// ObserveWithExemplar(), are only served when "$PREFIX-exemplars" is set, as
+// they require the OpenMetrics format.
+func MetricsServerFromFlags(cmd *cobra.Command, flagPrefix string) *http.Server {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "metrics")
+
+	handler := promhttp.Handler()
+	if MustGetBool(cmd, flagPrefix+"-exemplars") {
+		handler = promhttp.InstrumentMetricHandler(
+			prometheus.DefaultRegisterer,
+			promhttp.HandlerFor(prometheus.DefaultGatherer, promhttp.HandlerOpts{EnableOpenMetrics: true}),
+		)
+	}
+
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", handler)
+
+	return &http.Server{
+		Addr:    MustGetStringExpanded(cmd, flagPrefix+"-addr"),
+		Handler: mux,
+	}
+}
+
+// MetricsListenFromFlags listens on a metrics server using the configuration
+// stored in the cobra command that was registered with
+// RegisterMetricsServerFlags.
+func MetricsListenFromFlags(cmd *cobra.Command, flagPrefix string, srv *http.Server) error {
+	return MetricsListenFromFlagsContext(context.Background(), cmd, flagPrefix, srv)
+}
+
+// MetricsListenFromFlagsContext listens on a metrics server using the
+// configuration stored in the cobra command that was registered with
+// RegisterMetricsServerFlags.
+//
+// When the provided context is cancelled, the server is shutdown and nil is
+// returned.
+func MetricsListenFromFlagsContext(ctx context.Context, cmd *cobra.Command, flagPrefix string, srv *http.Server) error {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "metrics")
+
+	if !MustGetBool(cmd, flagPrefix+"-enabled") {
+		return nil
+	}
+
+	return serveHttpUntilDone(ctx, srv, flagPrefix, metricsShutdownGracePeriod, func() error {
+		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			return fmt.Errorf("failed while serving metrics: %w", err)
+		}
+		return nil
+	})
+}
@@ -3,6 +3,7 @@ package cobrautil
 import (
 	"net"
 	"os"
+	"strings"
 	"time"
 
 	"github.com/spf13/cobra"
@@ -84,6 +85,25 @@ func MustGetDurationSlice(cmd *cobra.Command, name string) []time.Duration {
 	return value
 }
 
+// MustGetEnum returns the string value of an EnumFlag with the given name and
+// panics if that flag was never defined.
+//
+// Plain string flags are also accepted, with their value lowercased, so that
+// flags registered without RegisterEnumFlag keep working.
+func MustGetEnum(cmd *cobra.Command, name string) string {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		panic("failed to find cobra flag: " + name)
+	}
+	if value, ok := flag.Value.(*EnumFlag); ok {
+		return value.String()
+	}
+	if flag.Value.Type() != "string" {
+		panic("cobra flag is not an enum or string flag: " + name)
+	}
+	return strings.ToLower(flag.Value.String())
+}
+
 // MustGetFloat32 returns the float32 value of a flag with the given name and
 // panics if that flag was never defined.
 func MustGetFloat32(cmd *cobra.Command, name string) float32 {
@@ -254,6 +274,16 @@ func MustGetString(cmd *cobra.Command, name string) string {
 	return value
 }
 
+// MustGetStringArray returns the []string value of a flag with the given name
+// and panics if that flag was never defined.
+func MustGetStringArray(cmd *cobra.Command, name string) []string {
+	value, err := cmd.Flags().GetStringArray(name)
+	if err != nil {
+		panic("failed to find cobra flag: " + name)
+	}
+	return value
+}
+
 // MustGetStringSlice returns the []string value of a flag with the given name
 // and panics if that flag was never defined.
 func MustGetStringSlice(cmd *cobra.Command, name string) []string {
@@ -264,8 +294,8 @@ func MustGetStringSlice(cmd *cobra.Command, name string) []string {
 	return value
 }
 
-// MustGetStringSlice returns the []string value of a flag with the given name,
-// calls os.ExpandEnv on values, and panics if that flag was never defined.
+// MustGetStringSliceExpanded returns the []string value of a flag with the
+// given name, calls os.ExpandEnv on values, and panics if that flag was never defined.
 func MustGetStringSliceExpanded(cmd *cobra.Command, name string) []string {
 	slice := MustGetStringSlice(cmd, name)
 	for i, str := range slice {
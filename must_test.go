@@ -0,0 +1,41 @@
+package cobrautil_test
+
+import (
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+func TestMustGetEnumAcceptsStringFlags(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cmd.Flags().String("log-level", "info", "")
+	cmd.Flags().String("log-format", "auto", "")
+	cmd.Flags().String("log-output", "stderr", "")
+	cmd.Flags().Bool("log-caller", false, "")
+	cmd.Flags().Bool("log-stacktrace", false, "")
+	if err := cmd.Flags().Set("log-level", "DEBUG"); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := cobrautil.MustGetEnum(cmd, "log-level"); got != "debug" {
+		t.Fatalf("got %q, want %q", got, "debug")
+	}
+	if err := cobrautil.ZeroLogPreRunE("log", zerolog.InfoLevel)(cmd, nil); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMustGetEnumPanicsOnOtherTypes(t *testing.T) {
+	cmd := &cobra.Command{Use: "mycmd"}
+	cmd.Flags().Int("workers", 1, "")
+
+	defer func() {
+		if r := recover(); r != "cobra flag is not an enum or string flag: workers" {
+			t.Fatalf("unexpected panic: %v", r)
+		}
+	}()
+	cobrautil.MustGetEnum(cmd, "workers")
+}
@@ -0,0 +1,110 @@
+package cobrautil
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"go.opentelemetry.io/otel/sdk/trace"
+)
+
+// fakeExporter is a trace.SpanExporter that records the calls made to it.
+type fakeExporter struct {
+	export  func(ctx context.Context) error
+	exports int
+}
+
+func (e *fakeExporter) ExportSpans(ctx context.Context, spans []trace.ReadOnlySpan) error {
+	e.exports++
+	if e.export != nil {
+		return e.export(ctx)
+	}
+	return nil
+}
+
+func (e *fakeExporter) Shutdown(ctx context.Context) error { return nil }
+
+func TestFailoverExporterLeavesTimeForFallback(t *testing.T) {
+	// The primary always fails, but only once its context expires, as an
+	// exporter retrying with backoff would.
+	primary := &fakeExporter{export: func(ctx context.Context) error {
+		<-ctx.Done()
+		return errors.New("collector unavailable")
+	}}
+	fallback := &fakeExporter{export: func(ctx context.Context) error {
+		return ctx.Err()
+	}}
+	exp := &failoverExporter{primary: primary, fallback: fallback}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if err := exp.ExportSpans(ctx, nil); err != nil {
+		t.Fatalf("expected fallback to export spans, got: %v", err)
+	}
+	if primary.exports != 1 || fallback.exports != 1 {
+		t.Fatalf("expected one export to each exporter, got primary=%d fallback=%d", primary.exports, fallback.exports)
+	}
+}
+
+func TestFailoverExporterPrefersPrimary(t *testing.T) {
+	primary, fallback := &fakeExporter{}, &fakeExporter{}
+	exp := &failoverExporter{primary: primary, fallback: fallback}
+
+	if err := exp.ExportSpans(context.Background(), nil); err != nil {
+		t.Fatal(err)
+	}
+	if primary.exports != 1 || fallback.exports != 0 {
+		t.Fatalf("expected only the primary to export, got primary=%d fallback=%d", primary.exports, fallback.exports)
+	}
+}
+
+func TestNewFailoverExporter(t *testing.T) {
+	primary, fallback := &fakeExporter{}, &fakeExporter{}
+	newExporter := func(available ...string) func(string) (trace.SpanExporter, error) {
+		return func(endpoint string) (trace.SpanExporter, error) {
+			for _, a := range available {
+				if a == endpoint {
+					if endpoint == "primary" {
+						return primary, nil
+					}
+					return fallback, nil
+				}
+			}
+			return nil, errors.New("unreachable: " + endpoint)
+		}
+	}
+
+	tests := []struct {
+		name      string
+		fallback  string
+		available []string
+		want      trace.SpanExporter
+		wantErr   bool
+	}{
+		{"primary only", "", []string{"primary"}, primary, false},
+		{"primary only unavailable", "", nil, nil, true},
+		{"primary unavailable", "fallback", []string{"fallback"}, fallback, false},
+		{"fallback unavailable", "fallback", []string{"primary"}, primary, false},
+		{"both unavailable", "fallback", nil, nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := newFailoverExporter("primary", tt.fallback, newExporter(tt.available...))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !tt.wantErr && got != tt.want {
+				t.Fatalf("got exporter %v, want %v", got, tt.want)
+			}
+		})
+	}
+
+	got, err := newFailoverExporter("primary", "fallback", newExporter("primary", "fallback"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := got.(*failoverExporter); !ok {
+		t.Fatalf("expected a failoverExporter, got %T", got)
+	}
+}
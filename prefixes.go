@@ -0,0 +1,65 @@
+package cobrautil
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+
+	"github.com/spf13/cobra"
+)
+
+// RegisteredPrefix is a flag prefix passed to one of the Register*Flags
+// functions in this package.
+type RegisteredPrefix struct {
+	Prefix string
+	Kind   string // One of "grpc", "http", "log", "metrics", or "otel".
+}
+
+var (
+	prefixesMu sync.Mutex
+	prefixes   = make(map[RegisteredPrefix]struct{})
+)
+
+func registerPrefix(prefix, kind string) {
+	prefixesMu.Lock()
+	defer prefixesMu.Unlock()
+	prefixes[RegisteredPrefix{Prefix: prefix, Kind: kind}] = struct{}{}
+}
+
+// RegisteredPrefixes returns every flag prefix that has been registered so
+// far, sorted by prefix and then kind.
+func RegisteredPrefixes() []RegisteredPrefix {
+	prefixesMu.Lock()
+	defer prefixesMu.Unlock()
+
+	registered := make([]RegisteredPrefix, 0, len(prefixes))
+	for p := range prefixes {
+		registered = append(registered, p)
+	}
+	sort.Slice(registered, func(i, j int) bool {
+		if registered[i].Prefix != registered[j].Prefix {
+			return registered[i].Prefix < registered[j].Prefix
+		}
+		return registered[i].Kind < registered[j].Kind
+	})
+	return registered
+}
+
+// DebugPrefixesCommand returns a hidden "debug-prefixes" command that prints
+// the result of RegisteredPrefixes().
+func DebugPrefixesCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:    "debug-prefixes",
+		Short:  "List the flag prefixes registered by cobrautil",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			for _, p := range RegisteredPrefixes() {
+				if _, err := fmt.Fprintf(cmd.OutOrStdout(), "%s\t%s\n", p.Prefix, p.Kind); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+}
@@ -0,0 +1,36 @@
+package cobrautil_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+func TestValidateFlagShorthands(t *testing.T) {
+	root := &cobra.Command{Use: "root"}
+	root.PersistentFlags().BoolP("verbose", "v", false, "")
+	child := &cobra.Command{Use: "child", Run: func(cmd *cobra.Command, args []string) {}}
+	child.Flags().BoolP("version", "v", false, "")
+	sibling := &cobra.Command{Use: "sibling", Run: func(cmd *cobra.Command, args []string) {}}
+	sibling.Flags().BoolP("quiet", "q", false, "")
+	root.AddCommand(child, sibling)
+
+	err := cobrautil.ValidateFlagShorthands(root)
+	if err == nil {
+		t.Fatal("expected an error for the collision between the parent and child")
+	}
+	if want := "root child: -v is used by both --version and --verbose"; !strings.Contains(err.Error(), want) {
+		t.Fatalf("got error %q, want it to contain %q", err, want)
+	}
+	if strings.Contains(err.Error(), "sibling") {
+		t.Fatalf("unexpected collision reported for sibling: %v", err)
+	}
+
+	child.Flags().Lookup("version").Shorthand = "V"
+	if err := cobrautil.ValidateFlagShorthands(root); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+}
@@ -0,0 +1,18 @@
+package slogutil_test
+
+import (
+	"log/slog"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/slogutil"
+)
+
+func ExampleSlogPreRunE() {
+	cmd := &cobra.Command{
+		Use:     "mycmd",
+		PreRunE: slogutil.SlogPreRunE("log", slog.LevelInfo),
+	}
+
+	slogutil.RegisterSlogFlags(cmd.PersistentFlags(), "log")
+}
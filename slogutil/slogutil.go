@@ -0,0 +1,191 @@
+// Package slogutil configures the standard library's log/slog from cobra
+// flags.
+//
+// It mirrors the logging helpers in cobrautil, but it does not depend on
+// cobrautil so that zerolog is not linked into programs that use it. The parts
+// that do not depend on a logging library are shared with cobrautil.
+package slogutil
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"github.com/jzelinskie/stringz"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+
+	"github.com/jzelinskie/cobrautil/internal/logflags"
+)
+
+// Levels that slog does not define but that are accepted by SlogPreRunE for
+// parity with cobrautil.ZeroLogPreRunE.
+const (
+	slogLevelTrace = slog.LevelDebug - 4
+	slogLevelFatal = slog.LevelError + 4
+	slogLevelPanic = slog.LevelError + 8
+)
+
+// ShouldSkipPreRun is called by SlogPreRunE to determine whether it should be
+// a no-op for the command being run.
+//
+// It defaults to IsBuiltinCommand and can be replaced in order to skip
+// additional commands, such as a "version" command. It is separate from
+// cobrautil.ShouldSkipPreRun, so a program using both must replace both.
+var ShouldSkipPreRun = IsBuiltinCommand
+
+// IsBuiltinCommand checks against a hard-coded list of the names of commands
+// that cobra provides out-of-the-box, the same as cobrautil.IsBuiltinCommand.
+func IsBuiltinCommand(cmd *cobra.Command) bool {
+	return logflags.IsBuiltinCommand(cmd)
+}
+
+// RegisterSlogFlags adds flags for use in with SlogPreRunE:
+// - "$PREFIX-level"
+// - "$PREFIX-format"
+// - "$PREFIX-output"
+// - "$PREFIX-max-size"
+// - "$PREFIX-max-backups"
+// - "$PREFIX-max-age"
+func RegisterSlogFlags(flags *pflag.FlagSet, flagPrefix string) {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "log")
+	flags.String(flagPrefix+"-level", "info", enumUsage("verbosity of logging", logflags.Levels))
+	flags.String(flagPrefix+"-format", "auto", enumUsage("format of logs", logflags.Formats))
+	logflags.RegisterOutputFlags(flags, flagPrefix)
+}
+
+// enumUsage appends the accepted values of a flag to its usage.
+func enumUsage(usage string, values []string) string {
+	quoted := make([]string, 0, len(values))
+	for _, value := range values {
+		quoted = append(quoted, strconv.Quote(value))
+	}
+	return usage + " (" + strings.Join(quoted, ", ") + ")"
+}
+
+// SlogPreRunE returns a Cobra run func that configures the default slog
+// logger from a command.
+//
+// A file named by "$PREFIX-output" is left open for the life of the process,
+// and is rotated as configured by the "$PREFIX-max-*" flags.
+//
+// The required flags can be added to a command by using RegisterSlogFlags().
+func SlogPreRunE(flagPrefix string, prerunLevel slog.Level) func(cmd *cobra.Command, args []string) error {
+	flagPrefix = stringz.DefaultEmpty(flagPrefix, "log")
+	return func(cmd *cobra.Command, args []string) error {
+		if ShouldSkipPreRun(cmd) {
+			return nil // No-op for builtins
+		}
+
+		var level slog.Level
+		levelName := strings.ToLower(mustGetString(cmd, flagPrefix+"-level"))
+		switch levelName {
+		case "trace":
+			level = slogLevelTrace
+		case "debug":
+			level = slog.LevelDebug
+		case "info":
+			level = slog.LevelInfo
+		case "warn":
+			level = slog.LevelWarn
+		case "error":
+			level = slog.LevelError
+		case "fatal":
+			level = slogLevelFatal
+		case "panic":
+			level = slogLevelPanic
+		default:
+			return fmt.Errorf("unknown log level: %s", levelName)
+		}
+
+		opts := &slog.HandlerOptions{Level: level, ReplaceAttr: replaceSlogLevel}
+		format := strings.ToLower(mustGetString(cmd, flagPrefix+"-format"))
+		if !stringz.SliceContains(logflags.Formats, format) {
+			return fmt.Errorf("unknown log format: %s", format)
+		}
+
+		output, human, err := logflags.OutputFromFlags(cmd.Flags(), flagPrefix, format)
+		if err != nil {
+			return err
+		}
+
+		var handler slog.Handler
+		switch {
+		case format == "gcp":
+			opts.ReplaceAttr = replaceSlogGcpSeverity
+			handler = slog.NewJSONHandler(output, opts)
+		case human:
+			handler = slog.NewTextHandler(output, opts)
+		default:
+			handler = slog.NewJSONHandler(output, opts)
+		}
+		slog.SetDefault(slog.New(handler))
+
+		slog.Log(context.Background(), prerunLevel, "set log level", "new level", levelName)
+		return nil
+	}
+}
+
+// mustGetString returns the string value of a flag with the given name and
+// panics if that flag was never defined.
+func mustGetString(cmd *cobra.Command, name string) string {
+	value, err := cmd.Flags().GetString(name)
+	if err != nil {
+		panic("failed to find cobra flag: " + name)
+	}
+	return value
+}
+
+// replaceSlogLevel names the levels that slog does not define.
+func replaceSlogLevel(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.LevelKey || len(groups) > 0 {
+		return a
+	}
+
+	switch level, _ := a.Value.Any().(slog.Level); level {
+	case slogLevelTrace:
+		a.Value = slog.StringValue("TRACE")
+	case slogLevelFatal:
+		a.Value = slog.StringValue("FATAL")
+	case slogLevelPanic:
+		a.Value = slog.StringValue("PANIC")
+	}
+	return a
+}
+
+// replaceSlogGcpSeverity maps slog levels to the severity values understood
+// by Google Cloud Logging.
+//
+// For low-level details see:
+// https://cloud.google.com/logging/docs/reference/v2/rest/v2/LogEntry#LogSeverity
+func replaceSlogGcpSeverity(groups []string, a slog.Attr) slog.Attr {
+	if a.Key != slog.LevelKey || len(groups) > 0 {
+		return a
+	}
+
+	level, _ := a.Value.Any().(slog.Level)
+	return slog.Attr{Key: "severity", Value: slog.StringValue(logflags.GcpSeverity(slogLevelName(level)))}
+}
+
+// slogLevelName returns the name of the most verbose of logflags.Levels that
+// includes the provided level.
+func slogLevelName(level slog.Level) string {
+	switch {
+	case level < slog.LevelDebug:
+		return "trace"
+	case level < slog.LevelInfo:
+		return "debug"
+	case level < slog.LevelWarn:
+		return "info"
+	case level < slog.LevelError:
+		return "warn"
+	case level < slogLevelFatal:
+		return "error"
+	case level < slogLevelPanic:
+		return "fatal"
+	default:
+		return "panic"
+	}
+}
@@ -0,0 +1,137 @@
+package slogutil_test
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil/slogutil"
+)
+
+// runSlogPreRunE runs SlogPreRunE with the provided flags and logs a message
+// at each of the provided levels, returning the JSON logs written, excluding
+// the one logged by SlogPreRunE itself.
+func runSlogPreRunE(t *testing.T, flags map[string]string, levels ...slog.Level) ([]map[string]interface{}, error) {
+	t.Helper()
+	orig := slog.Default()
+	t.Cleanup(func() { slog.SetDefault(orig) })
+
+	output := filepath.Join(t.TempDir(), "log")
+	cmd := &cobra.Command{Use: "mycmd"}
+	slogutil.RegisterSlogFlags(cmd.Flags(), "log")
+	if err := cmd.Flags().Set("log-output", output); err != nil {
+		t.Fatal(err)
+	}
+	for name, value := range flags {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := slogutil.SlogPreRunE("log", slog.LevelDebug-8)(cmd, nil); err != nil {
+		return nil, err
+	}
+
+	for _, level := range levels {
+		slog.Log(context.Background(), level, "test")
+	}
+
+	f, err := os.Open(output)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	var logs []map[string]interface{}
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		var entry map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			t.Fatalf("failed to parse log %q: %v", scanner.Text(), err)
+		}
+		if entry["msg"] == "test" {
+			logs = append(logs, entry)
+		}
+	}
+	return logs, scanner.Err()
+}
+
+var allLevels = []slog.Level{slog.LevelDebug - 4, slog.LevelDebug, slog.LevelInfo, slog.LevelWarn, slog.LevelError, slog.LevelError + 4, slog.LevelError + 8}
+
+func TestSlogPreRunELevels(t *testing.T) {
+	for _, tt := range []struct {
+		level string
+		want  []string
+	}{
+		{"trace", []string{"TRACE", "DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PANIC"}},
+		{"DEBUG", []string{"DEBUG", "INFO", "WARN", "ERROR", "FATAL", "PANIC"}},
+		{"info", []string{"INFO", "WARN", "ERROR", "FATAL", "PANIC"}},
+		{"warn", []string{"WARN", "ERROR", "FATAL", "PANIC"}},
+		{"error", []string{"ERROR", "FATAL", "PANIC"}},
+		{"fatal", []string{"FATAL", "PANIC"}},
+		{"panic", []string{"PANIC"}},
+	} {
+		t.Run(tt.level, func(t *testing.T) {
+			logs, err := runSlogPreRunE(t, map[string]string{"log-level": tt.level, "log-format": "json"}, allLevels...)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var got []string
+			for _, entry := range logs {
+				got = append(got, entry["level"].(string))
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("got levels %v, want %v", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Fatalf("got levels %v, want %v", got, tt.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSlogPreRunEInvalidFlags(t *testing.T) {
+	for _, tt := range []struct {
+		name    string
+		flags   map[string]string
+		wantErr string
+	}{
+		{"level", map[string]string{"log-level": "verbose"}, "unknown log level: verbose"},
+		{"format", map[string]string{"log-format": "xml"}, "unknown log format: xml"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := runSlogPreRunE(t, tt.flags)
+			if err == nil || err.Error() != tt.wantErr {
+				t.Fatalf("got error %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSlogPreRunEGcpSeverity(t *testing.T) {
+	logs, err := runSlogPreRunE(t, map[string]string{"log-level": "trace", "log-format": "gcp"}, allLevels...)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{"DEBUG", "DEBUG", "INFO", "WARNING", "ERROR", "CRITICAL", "ALERT"}
+	if len(logs) != len(want) {
+		t.Fatalf("got %d logs, want %d", len(logs), len(want))
+	}
+	for i, entry := range logs {
+		if _, ok := entry["level"]; ok {
+			t.Fatalf("expected the level to be replaced by the severity, got %v", entry)
+		}
+		if entry["severity"] != want[i] {
+			t.Fatalf("got severity %v for %s, want %s", entry["severity"], allLevels[i], want[i])
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package cobrautil
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/signal"
+	"runtime"
+	"syscall"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// DumpStacksOnSignal writes the stacks of all goroutines every time one of the
+// provided signals is received, until the provided context is cancelled.
+//
+// Unlike the Go runtime's handling of SIGQUIT, the process keeps running.
+// SIGQUIT is used if no signals are provided.
+//
+// If path is empty, the stacks are written to the logger without a level, so
+// that they are not filtered out by the global level; otherwise they are
+// appended to the file at that path.
+func DumpStacksOnSignal(ctx context.Context, path string, sigs ...os.Signal) {
+	if len(sigs) == 0 {
+		sigs = []os.Signal{syscall.SIGQUIT}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, sigs...)
+
+	go func() {
+		defer signal.Stop(ch)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case sig := <-ch:
+				if err := dumpStacks(path); err != nil {
+					log.Warn().Err(err).Str("signal", sig.String()).Msg("failed to dump goroutine stacks")
+				}
+			}
+		}
+	}()
+}
+
+func dumpStacks(path string) error {
+	buf := make([]byte, 1<<16)
+	for {
+		n := runtime.Stack(buf, true)
+		if n < len(buf) {
+			buf = buf[:n]
+			break
+		}
+		buf = make([]byte, 2*len(buf))
+	}
+
+	if path == "" {
+		log.WithLevel(zerolog.NoLevel).Str("stacks", string(buf)).Msg("dumped goroutine stacks")
+		return nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o644)
+	if err != nil {
+		return fmt.Errorf("failed to open stack dump file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := f.Write(buf); err != nil {
+		return fmt.Errorf("failed to write stack dump: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,29 @@
+package cobrautil
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+func TestDumpStacksIgnoresGlobalLevel(t *testing.T) {
+	origLogger, origLevel := log.Logger, zerolog.GlobalLevel()
+	defer func() {
+		log.Logger = origLogger
+		zerolog.SetGlobalLevel(origLevel)
+	}()
+
+	var buf bytes.Buffer
+	log.Logger = zerolog.New(&buf)
+	zerolog.SetGlobalLevel(zerolog.ErrorLevel)
+
+	if err := dumpStacks(""); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "TestDumpStacksIgnoresGlobalLevel") {
+		t.Fatalf("expected the stacks to be logged, got:\n%s", buf.String())
+	}
+}
@@ -0,0 +1,142 @@
+package cobrautil
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+)
+
+type startupKey struct{}
+
+type startup struct {
+	sync.Mutex
+	step    string
+	pending int
+	done    bool
+	timer   *time.Timer
+}
+
+// StartupDeadline returns a Cobra run func that exits the process if startup
+// does not complete within the provided duration.
+//
+// Startup completes once StartupComplete() has been called once for each of
+// the provided number of servers; GrpcListenFromFlags() and
+// HttpListenFromFlags() call it once they are listening, or immediately if
+// their server is disabled. If servers is 0, startup completes once the
+// command's RunE is called. Either way, the deadline is stopped when the RunE
+// returns, so a command that fails to listen is not exited later.
+//
+// The step that was pending is logged before exiting; steps can be named by
+// wrapping run funcs with StartupStep().
+//
+// This is intended to be the first run func of the PreRunE of each command
+// that serves. It should not be used in a PersistentPreRunE that is shared
+// with commands that never listen, such as a migration, because those would
+// be exited once they ran for longer than the deadline.
+func StartupDeadline(d time.Duration, servers int) CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if ShouldSkipPreRun(cmd) {
+			return nil // No-op for builtins
+		}
+
+		ctx := cmd.Context()
+		if ctx == nil {
+			ctx = context.Background()
+		}
+
+		s := &startup{step: "prerun", pending: servers}
+		s.timer = time.AfterFunc(d, func() {
+			s.Lock()
+			defer s.Unlock()
+			log.Fatal().
+				Str("pending step", s.step).
+				Int("pending servers", s.pending).
+				Dur("deadline", d).
+				Msg("startup deadline exceeded")
+		})
+		cmd.SetContext(context.WithValue(ctx, startupKey{}, s))
+		wrapRunForStartup(cmd, s)
+		return nil
+	}
+}
+
+// wrapRunForStartup wraps the provided command's run func, for a single
+// execution, so that it completes startup if no servers are expected and
+// stops the deadline once it returns.
+func wrapRunForStartup(cmd *cobra.Command, s *startup) {
+	begin := func() {
+		s.Lock()
+		defer s.Unlock()
+		if s.pending <= 0 {
+			s.stop()
+			return
+		}
+		s.step = "listen"
+	}
+	end := func() {
+		s.Lock()
+		defer s.Unlock()
+		s.stop()
+	}
+
+	switch run, runE := cmd.Run, cmd.RunE; {
+	case runE != nil:
+		cmd.RunE = func(c *cobra.Command, args []string) error {
+			cmd.RunE = runE
+			begin()
+			defer end()
+			return runE(c, args)
+		}
+	case run != nil:
+		cmd.Run = func(c *cobra.Command, args []string) {
+			cmd.Run = run
+			begin()
+			defer end()
+			run(c, args)
+		}
+	}
+}
+
+// StartupStep wraps the provided run func such that it is reported as the
+// pending step if the deadline set by StartupDeadline() is exceeded while it
+// runs.
+func StartupStep(name string, fn CobraRunFunc) CobraRunFunc {
+	return func(cmd *cobra.Command, args []string) error {
+		if s := startupFromCommand(cmd); s != nil {
+			s.Lock()
+			s.step = name
+			s.Unlock()
+		}
+		return fn(cmd, args)
+	}
+}
+
+// StartupComplete reports that one of the servers expected by
+// StartupDeadline() has started, stopping the deadline once all of them have.
+func StartupComplete(cmd *cobra.Command) {
+	if s := startupFromCommand(cmd); s != nil {
+		s.Lock()
+		defer s.Unlock()
+		if s.pending--; s.pending <= 0 {
+			s.stop()
+		}
+	}
+}
+
+// stop stops the deadline; the lock must be held.
+func (s *startup) stop() {
+	s.timer.Stop()
+	s.done = true
+}
+
+func startupFromCommand(cmd *cobra.Command) *startup {
+	ctx := cmd.Context()
+	if ctx == nil {
+		return nil
+	}
+	s, _ := ctx.Value(startupKey{}).(*startup)
+	return s
+}
@@ -0,0 +1,55 @@
+package cobrautil
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestStartupDeadline(t *testing.T) {
+	done := func(cmd *cobra.Command) bool {
+		s := startupFromCommand(cmd)
+		s.Lock()
+		defer s.Unlock()
+		return s.done
+	}
+
+	tests := []struct {
+		name        string
+		servers     int
+		completions int
+		wantDone    bool // once the completions are made during RunE
+	}{
+		{"no servers", 0, 0, true},
+		{"all servers listening", 2, 2, true},
+		{"some servers listening", 2, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var gotDone bool
+			cmd := &cobra.Command{
+				Use:     "mycmd",
+				PreRunE: StartupDeadline(time.Hour, tt.servers),
+				RunE: func(cmd *cobra.Command, args []string) error {
+					for i := 0; i < tt.completions; i++ {
+						StartupComplete(cmd)
+					}
+					gotDone = done(cmd)
+					return nil
+				},
+			}
+			cmd.SetArgs(nil)
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			if gotDone != tt.wantDone {
+				t.Fatalf("got startup done=%v during RunE, want %v", gotDone, tt.wantDone)
+			}
+			if !done(cmd) {
+				t.Fatal("expected the deadline to be stopped once RunE returned")
+			}
+		})
+	}
+}
@@ -0,0 +1,183 @@
+package cobrautil
+
+import (
+	"encoding/csv"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// RegisterStructFlags adds a flag to the provided FlagSet for every field of
+// the struct pointed to by cfg that has a "flag" tag.
+//
+// The "default" and "usage" tags set the default value and usage of the
+// flag. Fields may be of type string, bool, int, int64, uint, float64,
+// time.Duration, or []string.
+//
+// For example:
+//
+//	type Config struct {
+//		Addr string `flag:"grpc-addr" default:":50051" usage:"address to listen on"`
+//	}
+func RegisterStructFlags(flags *pflag.FlagSet, cfg interface{}) error {
+	fields, err := structFlagFields(cfg)
+	if err != nil {
+		return err
+	}
+
+	for _, field := range fields {
+		name := field.Tag.Get("flag")
+		usage := field.Tag.Get("usage")
+		def, err := structFlagDefault(field)
+		if err != nil {
+			return fmt.Errorf("invalid default for flag --%s: %w", name, err)
+		}
+
+		switch {
+		case field.Type == durationType:
+			flags.Duration(name, def.(time.Duration), usage)
+		case field.Type.Kind() == reflect.String:
+			flags.String(name, def.(string), usage)
+		case field.Type.Kind() == reflect.Bool:
+			flags.Bool(name, def.(bool), usage)
+		case field.Type.Kind() == reflect.Int:
+			flags.Int(name, def.(int), usage)
+		case field.Type.Kind() == reflect.Int64:
+			flags.Int64(name, def.(int64), usage)
+		case field.Type.Kind() == reflect.Uint:
+			flags.Uint(name, def.(uint), usage)
+		case field.Type.Kind() == reflect.Float64:
+			flags.Float64(name, def.(float64), usage)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+			flags.StringSlice(name, def.([]string), usage)
+		}
+	}
+	return nil
+}
+
+// structFlagDefault parses the "default" tag of the provided field into a
+// value of the type expected by the pflag function registering its flag.
+func structFlagDefault(field reflect.StructField) (interface{}, error) {
+	def := field.Tag.Get("default")
+	switch {
+	case field.Type == durationType:
+		if def == "" {
+			return time.Duration(0), nil
+		}
+		return time.ParseDuration(def)
+	case field.Type.Kind() == reflect.String:
+		return def, nil
+	case field.Type.Kind() == reflect.Bool:
+		if def == "" {
+			return false, nil
+		}
+		return strconv.ParseBool(def)
+	case field.Type.Kind() == reflect.Int:
+		if def == "" {
+			return 0, nil
+		}
+		v, err := strconv.ParseInt(def, 0, 0)
+		return int(v), err
+	case field.Type.Kind() == reflect.Int64:
+		if def == "" {
+			return int64(0), nil
+		}
+		return strconv.ParseInt(def, 0, 64)
+	case field.Type.Kind() == reflect.Uint:
+		if def == "" {
+			return uint(0), nil
+		}
+		v, err := strconv.ParseUint(def, 0, 0)
+		return uint(v), err
+	case field.Type.Kind() == reflect.Float64:
+		if def == "" {
+			return float64(0), nil
+		}
+		return strconv.ParseFloat(def, 64)
+	case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+		if def == "" {
+			return []string(nil), nil
+		}
+		// Parse the same way that pflag parses StringSlice values.
+		return csv.NewReader(strings.NewReader(def)).Read()
+	default:
+		return nil, fmt.Errorf("unsupported type %s", field.Type)
+	}
+}
+
+// PopulateStruct sets every field of the struct pointed to by cfg that has a
+// "flag" tag to the value of that flag on the provided command.
+//
+// The flags are expected to have been added by RegisterStructFlags().
+func PopulateStruct(cmd *cobra.Command, cfg interface{}) error {
+	fields, err := structFlagFields(cfg)
+	if err != nil {
+		return err
+	}
+
+	v := reflect.ValueOf(cfg).Elem()
+	flags := cmd.Flags()
+	for _, field := range fields {
+		name := field.Tag.Get("flag")
+
+		var value interface{}
+		switch {
+		case field.Type == durationType:
+			value, err = flags.GetDuration(name)
+		case field.Type.Kind() == reflect.String:
+			value, err = flags.GetString(name)
+		case field.Type.Kind() == reflect.Bool:
+			value, err = flags.GetBool(name)
+		case field.Type.Kind() == reflect.Int:
+			value, err = flags.GetInt(name)
+		case field.Type.Kind() == reflect.Int64:
+			value, err = flags.GetInt64(name)
+		case field.Type.Kind() == reflect.Uint:
+			value, err = flags.GetUint(name)
+		case field.Type.Kind() == reflect.Float64:
+			value, err = flags.GetFloat64(name)
+		case field.Type.Kind() == reflect.Slice && field.Type.Elem().Kind() == reflect.String:
+			value, err = flags.GetStringSlice(name)
+		default:
+			return fmt.Errorf("unsupported type %s for flag --%s", field.Type, name)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read flag --%s: %w", name, err)
+		}
+
+		v.FieldByIndex(field.Index).Set(reflect.ValueOf(value).Convert(field.Type))
+	}
+	return nil
+}
+
+// structFlagFields returns the fields with a "flag" tag of the struct pointed
+// to by cfg.
+func structFlagFields(cfg interface{}) ([]reflect.StructField, error) {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() != reflect.Ptr || v.Elem().Kind() != reflect.Struct {
+		return nil, fmt.Errorf("expected a pointer to a struct, got %T", cfg)
+	}
+
+	var fields []reflect.StructField
+	t := v.Elem().Type()
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if _, ok := field.Tag.Lookup("flag"); ok {
+			if !field.IsExported() {
+				return nil, fmt.Errorf("field %s has a flag tag but is unexported", field.Name)
+			}
+			if _, err := structFlagDefault(reflect.StructField{Type: field.Type}); err != nil {
+				return nil, fmt.Errorf("unsupported type %s for flag --%s", field.Type, field.Tag.Get("flag"))
+			}
+			fields = append(fields, field)
+		}
+	}
+	return fields, nil
+}
@@ -0,0 +1,100 @@
+package cobrautil_test
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+type structFlagsConfig struct {
+	Addr    string        `flag:"addr" default:":50051" usage:"address to listen on"`
+	Enabled bool          `flag:"enabled" default:"true"`
+	Workers int           `flag:"workers" default:"4"`
+	Limit   int64         `flag:"limit"`
+	Retries uint          `flag:"retries" default:"3"`
+	Ratio   float64       `flag:"ratio" default:"0.5"`
+	Timeout time.Duration `flag:"timeout" default:"5s"`
+	Tags    []string      `flag:"tags" default:"a,b"`
+	Ignored string
+}
+
+func populate(t *testing.T, args ...string) structFlagsConfig {
+	t.Helper()
+
+	var cfg structFlagsConfig
+	cmd := &cobra.Command{Use: "mycmd", RunE: func(cmd *cobra.Command, args []string) error { return nil }}
+	if err := cobrautil.RegisterStructFlags(cmd.Flags(), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	cmd.SetArgs(args)
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	var populated structFlagsConfig
+	if err := cobrautil.PopulateStruct(cmd, &populated); err != nil {
+		t.Fatal(err)
+	}
+	return populated
+}
+
+func TestStructFlagsDefaults(t *testing.T) {
+	want := structFlagsConfig{
+		Addr:    ":50051",
+		Enabled: true,
+		Workers: 4,
+		Retries: 3,
+		Ratio:   0.5,
+		Timeout: 5 * time.Second,
+		Tags:    []string{"a", "b"},
+	}
+	if got := populate(t); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestStructFlagsOverrideDefaults(t *testing.T) {
+	got := populate(t, "--addr", ":1234", "--enabled=false", "--limit", "10", "--timeout", "1m", "--tags", "c")
+	want := structFlagsConfig{
+		Addr:    ":1234",
+		Workers: 4,
+		Limit:   10,
+		Retries: 3,
+		Ratio:   0.5,
+		Timeout: time.Minute,
+		Tags:    []string{"c"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %+v, want %+v", got, want)
+	}
+}
+
+func TestStructFlagsInvalidStructs(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  interface{}
+	}{
+		{"not a pointer", structFlagsConfig{}},
+		{"unexported field", &struct {
+			addr string `flag:"addr"`
+		}{}},
+		{"unsupported type", &struct {
+			Addrs map[string]string `flag:"addrs"`
+		}{}},
+		{"invalid default", &struct {
+			Workers int `flag:"workers" default:"many"`
+		}{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{Use: "mycmd"}
+			if err := cobrautil.RegisterStructFlags(cmd.Flags(), tt.cfg); err == nil {
+				t.Fatal("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,177 @@
+package cobrautil
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestVerifyAllowedCNs(t *testing.T) {
+	cert := func(cn string, dnsNames ...string) [][]*x509.Certificate {
+		return [][]*x509.Certificate{{{Subject: pkix.Name{CommonName: cn}, DNSNames: dnsNames}}}
+	}
+
+	tests := []struct {
+		name    string
+		chains  [][]*x509.Certificate
+		wantErr bool
+	}{
+		{"common name", cert("client-a"), false},
+		{"dns name", cert("other", "other.example.com", "client-b.example.com"), false},
+		{"not allowed", cert("client-c", "client-c.example.com"), true},
+		{"partial match", cert("client-a.evil", "evil.client-b.example.com"), true},
+		{"no verified chains", nil, true},
+		{"empty verified chain", [][]*x509.Certificate{{}}, true},
+	}
+
+	verify := verifyAllowedCNs([]string{"client-a", "client-b.example.com"})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verify(nil, tt.chains); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestVerifyNotRevoked(t *testing.T) {
+	ca, caKey := newTestCert(t, "ca", nil, nil)
+	otherCA, otherCAKey := newTestCert(t, "other-ca", nil, nil)
+	revoked, _ := newTestCert(t, "revoked", ca, caKey)
+	valid, _ := newTestCert(t, "valid", ca, caKey)
+	otherValid, _ := newTestCert(t, "other-valid", otherCA, otherCAKey)
+
+	// Both CAs revoke the serial of the revoked certificate, but only the CRL
+	// of a certificate's own issuer applies to it.
+	var crlPEM []byte
+	for _, issuer := range []struct {
+		cert *x509.Certificate
+		key  *ecdsa.PrivateKey
+	}{{ca, caKey}, {otherCA, otherCAKey}} {
+		der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+			Number:                    big.NewInt(1),
+			ThisUpdate:                time.Now(),
+			NextUpdate:                time.Now().Add(time.Hour),
+			RevokedCertificateEntries: []x509.RevocationListEntry{{SerialNumber: revoked.SerialNumber, RevocationTime: time.Now()}},
+		}, issuer.cert, issuer.key)
+		if err != nil {
+			t.Fatal(err)
+		}
+		crlPEM = append(crlPEM, pem.EncodeToMemory(&pem.Block{Type: "X509 CRL", Bytes: der})...)
+	}
+	otherValid.SerialNumber = revoked.SerialNumber // Only the serial and issuer are checked against CRLs.
+
+	path := filepath.Join(t.TempDir(), "crl.pem")
+	if err := os.WriteFile(path, crlPEM, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	crls, err := crlsFromFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(crls) != 2 {
+		t.Fatalf("expected 2 CRLs, got %d", len(crls))
+	}
+
+	tests := []struct {
+		name    string
+		chains  [][]*x509.Certificate
+		wantErr bool
+	}{
+		{"valid", [][]*x509.Certificate{{valid, ca}}, false},
+		{"revoked", [][]*x509.Certificate{{revoked, ca}}, true},
+		{"revoked serial of another issuer", [][]*x509.Certificate{{otherValid, otherCA}}, false},
+		{"no verified chains", nil, true},
+	}
+
+	verify := verifyNotRevoked(crls[:1])
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := verify(nil, tt.chains); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+
+	// A CRL whose signature does not match the issuer is ignored.
+	forged := *crls[1]
+	forged.RawIssuer = crls[0].RawIssuer
+	if err := verifyNotRevoked([]*x509.RevocationList{&forged})(nil, [][]*x509.Certificate{{revoked, ca}}); err != nil {
+		t.Fatalf("expected a CRL not signed by the issuer to be ignored, got: %v", err)
+	}
+}
+
+func TestCrlsFromFileDER(t *testing.T) {
+	ca, caKey := newTestCert(t, "ca", nil, nil)
+	der, err := x509.CreateRevocationList(rand.Reader, &x509.RevocationList{
+		Number:     big.NewInt(1),
+		ThisUpdate: time.Now(),
+		NextUpdate: time.Now().Add(time.Hour),
+	}, ca, caKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "crl.der")
+	if err := os.WriteFile(path, der, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if crls, err := crlsFromFile(path); err != nil || len(crls) != 1 {
+		t.Fatalf("got %d CRLs and error %v, want 1 CRL", len(crls), err)
+	}
+
+	invalid := filepath.Join(dir, "invalid")
+	if err := os.WriteFile(invalid, []byte("not a CRL"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := crlsFromFile(invalid); err == nil {
+		t.Fatal("expected an error for a file without a CRL")
+	}
+}
+
+// newTestCert creates a certificate with the provided common name, signed by
+// the provided parent or self-signed as a CA if parent is nil.
+func newTestCert(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey) (*x509.Certificate, *ecdsa.PrivateKey) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	serial, err := rand.Int(rand.Reader, big.NewInt(1<<62))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tmpl := &x509.Certificate{
+		SerialNumber: serial,
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+	}
+	if parent == nil {
+		tmpl.IsCA = true
+		tmpl.BasicConstraintsValid = true
+		tmpl.KeyUsage |= x509.KeyUsageCertSign | x509.KeyUsageCRLSign
+		parent, parentKey = tmpl, key
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, key
+}
@@ -0,0 +1,124 @@
+package cobrautil_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog"
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+func TestAppliedEnvVarsLoggedAfterLoggingIsConfigured(t *testing.T) {
+	for _, level := range []string{"warn", "debug"} {
+		t.Run(level, func(t *testing.T) {
+			output := filepath.Join(t.TempDir(), "log")
+			t.Setenv("MYAPP_LOG_LEVEL", level)
+			t.Setenv("MYAPP_LOG_OUTPUT", output)
+			t.Setenv("MYAPP_LOG_FORMAT", "json")
+
+			cmd := &cobra.Command{
+				Use: "mycmd",
+				PreRunE: cobrautil.CommandStack(
+					cobrautil.SyncViperPreRunE("myapp"),
+					cobrautil.ZeroLogPreRunE("log", zerolog.InfoLevel),
+				),
+				RunE: func(cmd *cobra.Command, args []string) error { return nil },
+			}
+			cobrautil.RegisterZeroLogFlags(cmd.Flags(), "log")
+			cmd.SetArgs(nil)
+			if err := cmd.Execute(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[string]string{
+				"log-level":  "MYAPP_LOG_LEVEL",
+				"log-output": "MYAPP_LOG_OUTPUT",
+				"log-format": "MYAPP_LOG_FORMAT",
+			}
+			applied := cobrautil.AppliedEnvVars(cmd)
+			if len(applied) != len(want) {
+				t.Fatalf("got applied env vars %v, want %v", applied, want)
+			}
+			for flag, env := range want {
+				if applied[flag] != env {
+					t.Fatalf("got applied env vars %v, want %v", applied, want)
+				}
+			}
+
+			logs, err := os.ReadFile(output)
+			if err != nil {
+				t.Fatal(err)
+			}
+			logged := strings.Contains(string(logs), "applied flag values from environment variables")
+			if logged != (level == "debug") {
+				t.Fatalf("applied env vars logged=%v at level %s:\n%s", logged, level, logs)
+			}
+		})
+	}
+}
+
+func TestSyncViperPreRunEPrecedence(t *testing.T) {
+	config := filepath.Join(t.TempDir(), "config.yaml")
+	if err := os.WriteFile(config, []byte("cli: file\nenv: file\nfile: file\ntags: [a, b]\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("MYAPP_CLI", "env")
+	t.Setenv("MYAPP_ENV", "env")
+
+	cmd := &cobra.Command{
+		Use:     "mycmd",
+		PreRunE: cobrautil.SyncViperPreRunE("myapp"),
+		RunE:    func(cmd *cobra.Command, args []string) error { return nil },
+	}
+	cobrautil.RegisterConfigFileFlags(cmd.Flags(), "")
+	for _, name := range []string{"cli", "env", "file", "default"} {
+		cmd.Flags().String(name, "default", "")
+	}
+	cmd.Flags().StringSlice("tags", nil, "")
+	cmd.SetArgs([]string{"--config", config, "--cli", "cli"})
+	if err := cmd.Execute(); err != nil {
+		t.Fatal(err)
+	}
+
+	for name, want := range map[string]string{
+		"cli":     "cli",
+		"env":     "env",
+		"file":    "file",
+		"default": "default",
+		"tags":    "[a,b]",
+	} {
+		if got := cmd.Flags().Lookup(name).Value.String(); got != want {
+			t.Errorf("got --%s=%q, want %q", name, got, want)
+		}
+	}
+}
+
+func TestSyncViperPreRunEMissingConfigFile(t *testing.T) {
+	missing := filepath.Join(t.TempDir(), "missing.yaml")
+	for _, tt := range []struct {
+		name    string
+		args    []string
+		wantErr bool
+	}{
+		{"default path", nil, false},
+		{"explicit path", []string{"--config", missing}, true},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{
+				Use:     "mycmd",
+				PreRunE: cobrautil.SyncViperPreRunE("myapp"),
+				RunE:    func(cmd *cobra.Command, args []string) error { return nil },
+			}
+			cobrautil.RegisterConfigFileFlags(cmd.Flags(), missing)
+			cmd.SetArgs(tt.args)
+			cmd.SilenceErrors, cmd.SilenceUsage = true, true
+			if err := cmd.Execute(); (err != nil) != tt.wantErr {
+				t.Fatalf("got error %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,175 @@
+package cobrautil_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+	"github.com/spf13/cobra"
+
+	"github.com/jzelinskie/cobrautil"
+)
+
+func TestZeroLogPreRunEAutoOutput(t *testing.T) {
+	for _, tt := range []struct {
+		format     string
+		wantStdout bool
+	}{
+		{"auto", false}, // stdout is not a terminal in tests
+		{"json", false},
+		{"gcp", false},
+		{"human", true},
+	} {
+		t.Run(tt.format, func(t *testing.T) {
+			stdout, stderr := redirectStdio(t)
+
+			cmd := &cobra.Command{Use: "mycmd"}
+			cobrautil.RegisterZeroLogFlags(cmd.Flags(), "log")
+			if err := cmd.Flags().Set("log-format", tt.format); err != nil {
+				t.Fatal(err)
+			}
+			if err := cobrautil.ZeroLogPreRunE("log", zerolog.InfoLevel)(cmd, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			gotStdout, gotStderr := readFile(t, stdout), readFile(t, stderr)
+			if logged := strings.Contains(gotStdout, "set log level"); logged != tt.wantStdout {
+				t.Fatalf("logged to stdout=%v, want %v:\n%s", logged, tt.wantStdout, gotStdout)
+			}
+			if logged := strings.Contains(gotStderr, "set log level"); logged == tt.wantStdout {
+				t.Fatalf("logged to stderr=%v, want %v:\n%s", logged, !tt.wantStdout, gotStderr)
+			}
+		})
+	}
+}
+
+func TestZeroLogPreRunEFileOutput(t *testing.T) {
+	redirectStdio(t)
+	output := filepath.Join(t.TempDir(), "log")
+
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterZeroLogFlags(cmd.Flags(), "log")
+	if err := cmd.Flags().Set("log-output", output); err != nil {
+		t.Fatal(err)
+	}
+	if err := cobrautil.ZeroLogPreRunE("log", zerolog.InfoLevel)(cmd, nil); err != nil {
+		t.Fatal(err)
+	}
+	cobrautil.CloseAll(cmd)
+
+	if got := readFile(t, output); !strings.Contains(got, `"message":"set log level"`) {
+		t.Fatalf("expected JSON logs in the output file, got:\n%s", got)
+	}
+}
+
+func TestZeroLogPreRunEFileRotation(t *testing.T) {
+	redirectStdio(t)
+	dir := t.TempDir()
+	output := filepath.Join(dir, "log")
+
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterZeroLogFlags(cmd.Flags(), "log")
+	for name, value := range map[string]string{
+		"log-output":      output,
+		"log-max-size":    "1",
+		"log-max-backups": "1",
+	} {
+		if err := cmd.Flags().Set(name, value); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := cobrautil.ZeroLogPreRunE("log", zerolog.InfoLevel)(cmd, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// Write about 3MB of logs, enough to rotate the 1MB file twice.
+	line := strings.Repeat("x", 1024)
+	for i := 0; i < 3*1024; i++ {
+		log.Info().Str("line", line).Msg("filler")
+	}
+	cobrautil.CloseAll(cmd)
+
+	// Old backups are removed in the background.
+	var entries []os.DirEntry
+	for deadline := time.Now().Add(5 * time.Second); ; time.Sleep(10 * time.Millisecond) {
+		var err error
+		if entries, err = os.ReadDir(dir); err != nil {
+			t.Fatal(err)
+		}
+		if len(entries) == 2 || time.Now().After(deadline) {
+			break
+		}
+	}
+	if len(entries) != 2 {
+		t.Fatalf("expected the log file and one backup, got %d files", len(entries))
+	}
+	for _, entry := range entries {
+		info, err := entry.Info()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.Size() > 1024*1024 {
+			t.Fatalf("%s was not rotated at 1MB: %d bytes", entry.Name(), info.Size())
+		}
+	}
+}
+
+func TestZeroLogPreRunEUnopenableOutput(t *testing.T) {
+	redirectStdio(t)
+	output := filepath.Join(t.TempDir(), "missing", "log")
+
+	cmd := &cobra.Command{Use: "mycmd"}
+	cobrautil.RegisterZeroLogFlags(cmd.Flags(), "log")
+	if err := cmd.Flags().Set("log-output", output); err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Flags().Set("log-max-size", "1"); err != nil {
+		t.Fatal(err)
+	}
+	if err := cobrautil.ZeroLogPreRunE("log", zerolog.InfoLevel)(cmd, nil); err == nil {
+		t.Fatal("expected an error for a log file that cannot be opened")
+	}
+}
+
+// redirectStdio replaces os.Stdout, os.Stderr, and the global logger for the
+// duration of the test, along with the zerolog settings changed by the "gcp"
+// format, returning the paths of the files that now receive
+// stdout and stderr.
+func redirectStdio(t *testing.T) (stdoutPath, stderrPath string) {
+	t.Helper()
+	dir := t.TempDir()
+	stdoutPath, stderrPath = filepath.Join(dir, "stdout"), filepath.Join(dir, "stderr")
+
+	stdout, err := os.Create(stdoutPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stderr, err := os.Create(stderrPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	origStdout, origStderr, origLogger := os.Stdout, os.Stderr, log.Logger
+	origLevelFieldName, origLevelFieldMarshalFunc := zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc
+	os.Stdout, os.Stderr = stdout, stderr
+	t.Cleanup(func() {
+		os.Stdout, os.Stderr, log.Logger = origStdout, origStderr, origLogger
+		zerolog.LevelFieldName, zerolog.LevelFieldMarshalFunc = origLevelFieldName, origLevelFieldMarshalFunc
+		stdout.Close()
+		stderr.Close()
+	})
+	return stdoutPath, stderrPath
+}
+
+func readFile(t *testing.T, path string) string {
+	t.Helper()
+	contents, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(contents)
+}